@@ -0,0 +1,162 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/tetratelabs/multierror"
+)
+
+// DeprecatedAlias registers alias as a deprecated name of the flag name, which
+// allows flags to be renamed without breaking existing deployments. Values
+// provided through the alias are mapped onto the flag and Group logs a
+// warning once at startup. Setting both the alias and the flag to
+// conflicting values results in a validation error.
+func (f *FlagSet) DeprecatedAlias(name, alias string) error {
+	flag := f.Lookup(name)
+	if flag == nil {
+		return FlagError{Flag: name, Reason: "flag does not exist"}
+	}
+	if f.Lookup(alias) != nil {
+		return FlagError{Flag: alias, Reason: "flag already exists"}
+	}
+	f.AddFlag(&pflag.Flag{
+		Name:        alias,
+		Usage:       aliasUsage(name),
+		Value:       &aliasValue{name: alias, target: name, typ: flag.Value.Type()},
+		NoOptDefVal: flag.NoOptDefVal,
+	})
+	return nil
+}
+
+// aliasValue holds the raw values provided through a deprecated alias until
+// they are mapped onto the target flag.
+type aliasValue struct {
+	name, target string
+	typ          string
+	values       []string
+}
+
+// String implements pflag.Value.
+func (a *aliasValue) String() string {
+	if len(a.values) == 0 {
+		return ""
+	}
+	return a.values[len(a.values)-1]
+}
+
+// Set implements pflag.Value.
+func (a *aliasValue) Set(v string) error {
+	a.values = append(a.values, v)
+	return nil
+}
+
+// Type implements pflag.Value.
+func (a *aliasValue) Type() string { return a.typ }
+
+// aliasUsage returns the help text of a deprecated alias of the target flag.
+func aliasUsage(target string) string {
+	return "deprecated: use --" + target + " instead"
+}
+
+// isAlias returns true if the flag is a deprecated alias.
+func isAlias(f *pflag.Flag) bool {
+	_, ok := f.Value.(*aliasValue)
+	return ok
+}
+
+// aliasTarget returns the name of the flag targeted by a deprecated alias,
+// including its namespace, or the provided name if not an alias.
+func (g *Group) aliasTarget(name string) string {
+	f := g.f.Lookup(name)
+	if f == nil {
+		return name
+	}
+	a, ok := f.Value.(*aliasValue)
+	if !ok {
+		return name
+	}
+	return strings.TrimSuffix(f.Name, a.name) + a.target
+}
+
+// resolveAliases maps the values provided through deprecated aliases onto
+// their target flags.
+func (g *Group) resolveAliases() error {
+	var err error
+	for _, fs := range g.fs {
+		if fs == nil {
+			continue
+		}
+		fs.VisitAll(func(f *pflag.Flag) {
+			a, ok := f.Value.(*aliasValue)
+			if !ok || !f.Changed {
+				return
+			}
+			target := fs.Lookup(strings.TrimSuffix(f.Name, a.name) + a.target)
+			g.Logger.Info("deprecated flag used", "flag", f.Name, "replacement", target.Name)
+
+			if !target.Changed {
+				for _, v := range a.values {
+					if sErr := target.Value.Set(v); sErr != nil {
+						err = multierror.Append(err, FlagError{Flag: f.Name, Reason: sErr.Error()})
+						return
+					}
+				}
+				target.Changed = true
+				return
+			}
+
+			// both the alias and its target were provided: find out if the
+			// alias values result in the same value as provided to the target
+			s := snapshotFlag(target)
+			for _, v := range a.values {
+				if sErr := target.Value.Set(v); sErr != nil {
+					err = multierror.Append(err, FlagError{Flag: f.Name, Reason: sErr.Error()})
+					break
+				}
+			}
+			aliased := target.Value.String()
+			if rErr := s.restore(); rErr != nil {
+				err = multierror.Append(err, FlagError{Flag: target.Name, Reason: rErr.Error()})
+				return
+			}
+			if aliased != s.value {
+				err = multierror.Append(err, FlagError{
+					Flag:   f.Name,
+					Reason: "conflicts with --" + target.Name,
+				})
+			}
+		})
+	}
+	return err
+}
+
+// canonicalEntries returns the config file entries with deprecated aliases
+// replaced by their target flags. Entries for the target flag take precedence.
+func (g *Group) canonicalEntries(entries configEntries) configEntries {
+	canonical := make(configEntries, len(entries))
+	for key, values := range entries {
+		if target := g.aliasTarget(key); target != key {
+			if _, ok := entries[target]; !ok {
+				canonical[target] = values
+			}
+			continue
+		}
+		canonical[key] = values
+	}
+	return canonical
+}
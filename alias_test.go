@@ -0,0 +1,101 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tetratelabs/telemetry"
+	"github.com/tetratelabs/telemetry/function"
+
+	"github.com/tetratelabs/run"
+)
+
+func TestDeprecatedAlias(t *testing.T) {
+	for _, tt := range []struct {
+		args     []string
+		addr     string
+		warnings int
+		err      string
+	}{
+		{args: []string{}, addr: "localhost"},
+		{args: []string{"--listen-addr", "new"}, addr: "new"},
+		{args: []string{"--addr", "old"}, addr: "old", warnings: 1},
+		{args: []string{"--addr", "same", "--listen-addr", "same"}, addr: "same", warnings: 1},
+		{args: []string{"--addr", "old", "--listen-addr", "new"}, err: "--addr: conflicts with --listen-addr"},
+		{args: []string{"--timeout", "5s", "--wait", "5000ms"}, addr: "localhost", warnings: 1},
+	} {
+		var (
+			warnings int
+			unit     aliasConfig
+			g        = run.Group{
+				Logger: function.NewLogger(func(_ telemetry.Level, msg string, _ error, _ function.Values) {
+					if msg == "deprecated flag used" {
+						warnings++
+					}
+				}),
+			}
+		)
+		g.Register(&unit)
+		err := g.RunConfig(tt.args...)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%v: expected error %q, got %v", tt.args, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", tt.args, err)
+		}
+		if unit.addr != tt.addr {
+			t.Errorf("%v: want addr %q, have %q", tt.args, tt.addr, unit.addr)
+		}
+		if warnings != tt.warnings {
+			t.Errorf("%v: want %d warnings, have %d", tt.args, tt.warnings, warnings)
+		}
+	}
+
+	g := run.Group{Logger: telemetry.NoopLogger()}
+	g.Register(&aliasConfig{})
+	have := captureStdout(t, func() { _ = g.RunConfig("--help") })
+	if want := "deprecated: use --listen-addr instead"; !strings.Contains(have, want) {
+		t.Errorf("expected help to contain %q:\n%s", want, have)
+	}
+
+	g = run.Group{Logger: telemetry.NoopLogger(), FlagNamespaces: true}
+	g.Register(&aliasConfig{})
+	have = captureStdout(t, func() { _ = g.RunConfig("--help") })
+	if want := "deprecated: use --alias.listen-addr instead"; !strings.Contains(have, want) {
+		t.Errorf("expected namespaced help to contain %q:\n%s", want, have)
+	}
+}
+
+type aliasConfig struct {
+	addr string
+}
+
+func (a aliasConfig) Name() string { return "alias" }
+
+func (a *aliasConfig) FlagSet() *run.FlagSet {
+	flags := run.NewFlagSet("alias config")
+	flags.StringVar(&a.addr, "listen-addr", "localhost", "listen address")
+	flags.Duration("timeout", 0, "timeout")
+	_ = flags.DeprecatedAlias("listen-addr", "addr")
+	_ = flags.DeprecatedAlias("timeout", "wait")
+	return flags
+}
+
+func (a aliasConfig) Validate() error { return nil }
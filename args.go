@@ -0,0 +1,124 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidArgs is returned when the positional arguments do not match the
+// arity declared by a Config Unit's FlagSet.
+const ErrInvalidArgs Error = "invalid arguments"
+
+// ArgsReceiver is implemented by Config Units that consume the positional
+// arguments left after flag parsing (and subcommand selection).
+type ArgsReceiver interface {
+	Config
+	// ReceiveArgs is called with the positional arguments before Validate.
+	ReceiveArgs(args []string)
+}
+
+// argSpec holds the declared arity of the positional arguments.
+type argSpec struct {
+	min, max int
+	names    []string
+}
+
+// ExpectArgs declares the number of positional arguments accepted. A max
+// smaller than zero allows an unlimited number of arguments. The optional
+// names are used in the usage line of help output and documentation, e.g.
+// ExpectArgs(1, -1, "FILE") results in "FILE ...".
+func (f *FlagSet) ExpectArgs(min, max int, names ...string) {
+	f.args = &argSpec{min: min, max: max, names: names}
+}
+
+// ExactArgs declares the named positional arguments to be required, not
+// accepting any additional arguments.
+func (f *FlagSet) ExactArgs(names ...string) {
+	f.ExpectArgs(len(names), len(names), names...)
+}
+
+// usage returns the usage line representation of the positional arguments.
+// Unnamed arguments are shown as ARG and the last name is repeated up to the
+// maximum number of arguments, e.g. "SRC [DST] [DST]" for ExpectArgs(1, 3,
+// "SRC", "DST").
+func (a *argSpec) usage() string {
+	names := append([]string(nil), a.names...)
+	if len(names) == 0 && a.max != 0 {
+		names = append(names, "ARG")
+	}
+	for len(names) > 0 && (len(names) < a.min || len(names) < a.max) {
+		names = append(names, names[len(names)-1])
+	}
+
+	var parts []string
+	for idx, name := range names {
+		if idx >= a.min {
+			name = "[" + name + "]"
+		}
+		parts = append(parts, name)
+	}
+	if a.max < 0 {
+		parts = append(parts, "...")
+	}
+	return strings.Join(parts, " ")
+}
+
+// checkArgs validates the positional arguments against the declared arity.
+func (f *FlagSet) checkArgs(args []string) error {
+	if f == nil || f.args == nil {
+		return nil
+	}
+	a := f.args
+	if len(args) >= a.min && (a.max < 0 || len(args) <= a.max) {
+		return nil
+	}
+	var expected string
+	switch {
+	case a.min == a.max:
+		expected = fmt.Sprintf("exactly %d", a.min)
+	case a.max < 0:
+		expected = fmt.Sprintf("at least %d", a.min)
+	case a.min == 0:
+		expected = fmt.Sprintf("at most %d", a.max)
+	default:
+		expected = fmt.Sprintf("between %d and %d", a.min, a.max)
+	}
+	if usage := a.usage(); usage != "" {
+		expected += " (" + usage + ")"
+	}
+	return fmt.Errorf("%w: expected %s, got %d", ErrInvalidArgs, expected, len(args))
+}
+
+// Args returns the positional arguments left after flag parsing and
+// subcommand selection. It is populated by RunConfig.
+func (g *Group) Args() []string {
+	return g.args
+}
+
+// argsUsage returns the usage line representation of the positional arguments
+// declared by the Config Units.
+func (g *Group) argsUsage() string {
+	var parts []string
+	for _, fs := range g.fs {
+		if fs != nil && fs.args != nil {
+			if usage := fs.args.usage(); usage != "" {
+				parts = append(parts, usage)
+			}
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,95 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tetratelabs/telemetry"
+
+	"github.com/tetratelabs/run"
+)
+
+func TestArgs(t *testing.T) {
+	for _, tt := range []struct {
+		min, max int
+		names    []string
+		args     []string
+		usage    string
+		err      string
+	}{
+		{min: 1, max: 1, names: []string{"FILE"}, args: []string{"a.txt"}, usage: "FILE"},
+		{min: 1, max: 1, names: []string{"FILE"}, args: []string{}, err: "expected exactly 1 (FILE), got 0"},
+		{min: 1, max: 2, names: []string{"SRC", "DST"}, args: []string{"a", "b"}, usage: "SRC [DST]"},
+		{min: 1, max: 2, names: []string{"SRC", "DST"}, args: []string{"a", "b", "c"}, err: "expected between 1 and 2 (SRC [DST]), got 3"},
+		{min: 1, max: -1, names: []string{"FILE"}, args: []string{"a", "b", "c"}, usage: "FILE ..."},
+		{min: 1, max: 3, names: []string{"SRC", "DST"}, args: []string{"a", "b", "c"}, usage: "SRC [DST] [DST]"},
+		{min: 2, max: -1, args: []string{"a"}, err: "expected at least 2 (ARG ARG ...), got 1"},
+		{min: 0, max: -1, args: []string{"a"}, usage: "[ARG] ..."},
+		{min: 0, max: 1, args: []string{"a", "b"}, err: "expected at most 1 ([ARG]), got 2"},
+		{min: 2, max: 2, args: []string{"a", "b"}, usage: "ARG ARG"},
+	} {
+		var (
+			unit = argsConfig{min: tt.min, max: tt.max, names: tt.names}
+			g    = run.Group{Name: "cp", Logger: telemetry.NoopLogger()}
+		)
+		g.Register(&unit)
+		err := g.RunConfig(append([]string{"--verbose"}, tt.args...)...)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%v: expected error %q, got %v", tt.args, tt.err, err)
+			}
+			if unit.args != nil {
+				t.Errorf("%v: expected args not to be received on error", tt.args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", tt.args, err)
+		}
+		if !reflect.DeepEqual(tt.args, unit.args) || !reflect.DeepEqual(tt.args, g.Args()) {
+			t.Errorf("%v: unexpected args received: %v, %v", tt.args, unit.args, g.Args())
+		}
+
+		g = run.Group{Name: "cp", Logger: telemetry.NoopLogger()}
+		g.Register(&argsConfig{min: tt.min, max: tt.max, names: tt.names})
+		have := captureStdout(t, func() { _ = g.RunConfig("--help") })
+		if want := "cp [flags] " + tt.usage + "\n"; !strings.Contains(have, want) {
+			t.Errorf("expected usage line %q:\n%s", want, have)
+		}
+	}
+}
+
+type argsConfig struct {
+	min, max int
+	names    []string
+	verbose  bool
+	args     []string
+}
+
+func (a argsConfig) Name() string { return "args" }
+
+func (a *argsConfig) FlagSet() *run.FlagSet {
+	flags := run.NewFlagSet("args config")
+	flags.BoolVar(&a.verbose, "verbose", false, "verbose output")
+	flags.ExpectArgs(a.min, a.max, a.names...)
+	return flags
+}
+
+func (a argsConfig) Validate() error { return nil }
+
+func (a *argsConfig) ReceiveArgs(args []string) { a.args = args }
@@ -0,0 +1,214 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrUnknownCommand is returned when the positional arguments do not select a
+// registered subcommand and are not accepted by the Config Units either.
+const ErrUnknownCommand Error = "unknown command"
+
+// command holds a named subcommand and the Units to register with Group if
+// the subcommand is selected.
+type command struct {
+	name     string
+	helpText string
+	units    []Unit
+}
+
+// RegisterCommand registers a named subcommand with its own set of Units,
+// allowing for git-style CLIs (e.g. "mytool serve", "mytool migrate up").
+// Run dispatches on the positional arguments: if they start with the name of
+// a registered subcommand, the subcommand's Units are registered with Group
+// and take part in all phases, next to the Units registered directly with
+// Group. Nested subcommands are registered by using multiple space separated
+// words as name, e.g. "migrate up". The longest matching name wins.
+// Positional arguments selecting no subcommand result in ErrUnknownCommand,
+// unless a Config Unit declared to accept them through ExpectArgs.
+// The Common Service options are shared by all subcommands and help is
+// available per subcommand, e.g. "mytool migrate up --help".
+// HelpText supports the BinaryName template variable.
+//
+// RegisterCommand must be called before RunConfig or Run.
+func (g *Group) RegisterCommand(name, helpText string, units ...Unit) {
+	g.cmds = append(g.cmds, command{
+		name:     strings.Join(strings.Fields(name), " "),
+		helpText: helpText,
+		units:    units,
+	})
+}
+
+// selectCommand finds the registered subcommand requested by the provided
+// arguments. It returns the index of the selected subcommand or -1 if no
+// subcommand was requested, as well as the arguments with the subcommand
+// words removed.
+func (g *Group) selectCommand(fs *FlagSet, args []string) (int, []string) {
+	if len(g.cmds) == 0 {
+		return -1, args
+	}
+
+	// collect the leading positional arguments, skipping over the flags and
+	// flag values we know of.
+	var words []int
+	for idx := 0; idx < len(args); idx++ {
+		arg := args[idx]
+		if arg == "--" {
+			break
+		}
+		if len(arg) > 1 && arg[0] == '-' {
+			if len(words) > 0 {
+				break
+			}
+			if !strings.Contains(arg, "=") && flagNeedsValue(fs, arg) {
+				idx++
+			}
+			continue
+		}
+		words = append(words, idx)
+	}
+
+	// find the longest matching subcommand name
+	var (
+		selected = -1
+		length   int
+	)
+	for cIdx, cmd := range g.cmds {
+		parts := strings.Fields(cmd.name)
+		if len(parts) == 0 || len(parts) > len(words) || len(parts) <= length {
+			continue
+		}
+		match := true
+		for pIdx, part := range parts {
+			if args[words[pIdx]] != part {
+				match = false
+				break
+			}
+		}
+		if match {
+			selected, length = cIdx, len(parts)
+		}
+	}
+	if selected == -1 {
+		return -1, args
+	}
+
+	rest := make([]string, 0, len(args)-length)
+	rest = append(rest, args[:words[0]]...)
+	rest = append(rest, args[words[length-1]+1:]...)
+	return selected, rest
+}
+
+// checkCommand returns an error if the positional arguments left after
+// subcommand selection name an unknown subcommand or a parent of nested
+// subcommands without Units of its own (e.g. "migrate" if only "migrate up" was
+// registered). Positional arguments are passed on as is if a Config Unit
+// declared to accept them.
+func (g *Group) checkCommand() error {
+	if len(g.cmds) == 0 || len(g.args) == 0 {
+		return nil
+	}
+	for _, fs := range g.fs {
+		if fs != nil && fs.args != nil {
+			return nil
+		}
+	}
+
+	var path []string
+	if g.cmd != nil {
+		path = strings.Fields(g.cmd.name)
+	}
+	words := g.args
+	for len(words) > 0 && len(g.subcommands(append(path, words[0]))) > 0 {
+		path, words = append(path, words[0]), words[1:]
+	}
+	available := g.subcommands(path)
+	if len(available) == 0 {
+		return nil
+	}
+	if len(words) > 0 {
+		path = append(path, words[0])
+	}
+	name := strings.Join(path, " ")
+	for _, a := range available {
+		if a == name {
+			// subcommand words found after the first flag are not selected
+			return fmt.Errorf("%w: %q (subcommand names must precede flags)",
+				ErrUnknownCommand, name)
+		}
+	}
+	return fmt.Errorf("%w: %q (available: %s)",
+		ErrUnknownCommand, name, strings.Join(available, ", "))
+}
+
+// subcommands returns the sorted names of the subcommands one level below the
+// provided path of subcommand words.
+func (g *Group) subcommands(path []string) []string {
+	var (
+		names []string
+		seen  = make(map[string]bool)
+	)
+	for _, cmd := range g.cmds {
+		parts := strings.Fields(cmd.name)
+		if len(parts) <= len(path) {
+			continue
+		}
+		match := true
+		for idx, part := range path {
+			if parts[idx] != part {
+				match = false
+				break
+			}
+		}
+		if name := strings.Join(parts[:len(path)+1], " "); match && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// flagNeedsValue returns true if the provided argument references a known flag
+// that consumes the next argument as its value.
+func flagNeedsValue(fs *FlagSet, arg string) bool {
+	var f = fs.Lookup(strings.TrimLeft(arg, "-"))
+	if arg[1] != '-' {
+		// shorthand(s), only the last one can consume a value
+		f = fs.ShorthandLookup(arg[len(arg)-1:])
+	}
+	return f != nil && f.NoOptDefVal == ""
+}
+
+// usageName returns the Group name, followed by the selected subcommand if
+// applicable.
+func (g *Group) usageName() string {
+	if g.cmd == nil {
+		return g.Name
+	}
+	return g.Name + " " + g.cmd.name
+}
+
+// helpText returns the help text of the selected subcommand or the Group's
+// HelpText if no subcommand was selected.
+func (g *Group) helpText() string {
+	if g.cmd == nil {
+		return g.HelpText
+	}
+	return g.cmd.helpText
+}
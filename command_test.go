@@ -0,0 +1,122 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tetratelabs/telemetry"
+
+	"github.com/tetratelabs/run"
+)
+
+func TestCommandDispatch(t *testing.T) {
+	for idx, tt := range []struct {
+		args      []string
+		migrate   int
+		migrateUp int
+		root      int
+		err       string
+	}{
+		{args: []string{"--root", "10"}, root: 10},
+		{args: []string{"migrate"}, migrate: 10, migrateUp: 0, root: 10},
+		{args: []string{"migrate", "--flagtest=3"}, migrate: 3, migrateUp: 0, root: 10},
+		{args: []string{"-n", "migrate", "migrate", "up", "-f", "4"}, migrateUp: 4, root: 10},
+		{args: []string{"migrate", "down"}, err: `unknown command: "migrate down" (available: migrate up)`},
+		{args: []string{"migrate", "--root", "2", "up"}, err: `unknown command: "migrate up" (subcommand names must precede flags)`},
+		{args: []string{"migrat"}, err: `unknown command: "migrat" (available: migrate, serve)`},
+		{args: []string{"serve"}, err: `unknown command: "serve" (available: serve all)`},
+		{args: []string{"unknown", "-f", "4"}, err: "unknown shorthand flag"},
+	} {
+		var (
+			g         = run.Group{Logger: telemetry.NoopLogger()}
+			root      = rootConfig{}
+			migrate   = &flagTestConfig{}
+			migrateUp = &flagTestConfig{}
+		)
+		g.Register(&root)
+		g.RegisterCommand("migrate", "run database migrations", migrate)
+		g.RegisterCommand(" migrate   up ", "run up migrations", migrateUp)
+		g.RegisterCommand("serve all", "serve all endpoints")
+
+		err := g.Run(tt.args...)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("[%d] Expected error containing %q, got %v", idx, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%d] Expected proper close, got %v", idx, err)
+		}
+		if want, have := tt.migrate, migrate.value; want != have {
+			t.Errorf("[%d] migrate: want %d, have %d", idx, want, have)
+		}
+		if want, have := tt.migrateUp, migrateUp.value; want != have {
+			t.Errorf("[%d] migrate up: want %d, have %d", idx, want, have)
+		}
+		if want, have := tt.root, root.value; want != have {
+			t.Errorf("[%d] root: want %d, have %d", idx, want, have)
+		}
+	}
+}
+
+func TestCommandRootArgs(t *testing.T) {
+	var (
+		g    = run.Group{Logger: telemetry.NoopLogger()}
+		root = argsConfig{min: 0, max: -1, names: []string{"FILE"}}
+	)
+	g.Register(&root)
+	g.RegisterCommand("migrate up", "run up migrations", &flagTestConfig{})
+
+	if err := g.RunConfig("migrat", "a.txt"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want, have := []string{"migrat", "a.txt"}, root.args; !reflect.DeepEqual(want, have) {
+		t.Errorf("want args %v, have %v", want, have)
+	}
+}
+
+func TestCommandHelp(t *testing.T) {
+	for _, args := range [][]string{
+		{"--help"},
+		{"migrate", "--help"},
+		{"migrate", "up", "-h"},
+	} {
+		g := run.Group{Logger: telemetry.NoopLogger()}
+		g.RegisterCommand("migrate", "run database migrations", &flagTestConfig{})
+		g.RegisterCommand("migrate up", "run up migrations", &flagTestConfig{})
+
+		if err := g.RunConfig(args...); err != run.ErrBailEarlyRequest {
+			t.Errorf("%v: Expected bail early request, got %v", args, err)
+		}
+	}
+}
+
+type rootConfig struct {
+	value int
+}
+
+func (r rootConfig) Name() string { return "root" }
+
+func (r *rootConfig) FlagSet() *run.FlagSet {
+	flags := run.NewFlagSet("root config")
+	flags.IntVar(&r.value, "root", 10, "root flag")
+	return flags
+}
+
+func (r rootConfig) Validate() error { return nil }
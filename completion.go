@@ -0,0 +1,475 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// Completion describes how a shell can complete the value of a flag.
+type Completion struct {
+	// Values holds the set of values the flag accepts, e.g. enum values.
+	Values []string
+	// Files completes the flag value with file paths.
+	Files bool
+	// Extensions optionally limits file path completion to files having one
+	// of the provided extensions (without leading dot).
+	Extensions []string
+	// Dirs completes the flag value with directory paths.
+	Dirs bool
+}
+
+// Completer is an extension interface that Config Units can implement if they
+// want to provide value completions for their flags in the shell completion
+// scripts generated by Group through the hidden --completion flag.
+// Completions returns the Completion for each flag keyed by the flag name as
+// registered in the Unit's FlagSet.
+type Completer interface {
+	// Unit is embedded for Group registration and identification
+	Unit
+	Completions() map[string]Completion
+}
+
+// ErrUnsupportedShell is returned when requesting a completion script for a
+// shell that is not supported.
+const ErrUnsupportedShell Error = "unsupported shell for completion"
+
+var nonIdentifier = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// completionFlag holds the details of a flag needed for completion scripts.
+type completionFlag struct {
+	*pflag.Flag
+	completion Completion
+	hasValue   bool
+}
+
+// completionCommand holds the details of a (nested) subcommand needed for
+// completion scripts.
+type completionCommand struct {
+	// path holds the space separated subcommand words, empty for the binary
+	// itself.
+	path string
+	// flags holds the flags only accepted by the subcommand.
+	flags []completionFlag
+	// children holds the subcommands one level down.
+	children []command
+}
+
+// words returns the subcommand words of the command.
+func (c completionCommand) words() []string {
+	return strings.Fields(c.path)
+}
+
+// writeCompletion writes the completion script for the requested shell,
+// covering the Common Service options, the flags of all registered Config
+// Units and the registered subcommands with the flags of their Config Units.
+// If a subcommand was selected, the script only covers that subcommand.
+func (g *Group) writeCompletion(w io.Writer, shell string) error {
+	var (
+		bin = path.Base(os.Args[0])
+		fn  = "_" + nonIdentifier.ReplaceAllString(bin, "_") + "_completion"
+	)
+
+	// collect the completions implied by flag rules and the ones provided by
+	// Config Units, the latter taking precedence
+	completions := make(map[string]Completion)
+	for _, fs := range g.fs {
+		for name, completion := range fs.ruleCompletions() {
+			completions[name] = completion
+		}
+	}
+	for _, c := range g.c {
+		if c != nil {
+			g.unitCompletions(c, completions)
+		}
+	}
+
+	var flags []completionFlag
+	g.f.VisitAll(func(f *pflag.Flag) {
+		if c, ok := newCompletionFlag(f, completions); ok {
+			flags = append(flags, c)
+		}
+	})
+	cmds := []*completionCommand{{flags: flags}}
+	if g.cmd == nil {
+		cmds = g.completionCommands(cmds[0])
+	}
+
+	switch shell {
+	case "bash":
+		writeBashCompletion(w, bin, fn, cmds)
+	case "zsh":
+		writeZshCompletion(w, bin, fn, cmds)
+	case "fish":
+		writeFishCompletion(w, bin, cmds)
+	default:
+		return fmt.Errorf("%w: %q (supported: bash, zsh, fish)",
+			ErrUnsupportedShell, shell)
+	}
+	return nil
+}
+
+// newCompletionFlag returns the completion details of a flag, if it should
+// be completed.
+func newCompletionFlag(f *pflag.Flag, completions map[string]Completion) (completionFlag, bool) {
+	if f.Hidden || f.Deprecated != "" || isAlias(f) {
+		return completionFlag{}, false
+	}
+	return completionFlag{
+		Flag:       f,
+		completion: completions[f.Name],
+		hasValue:   f.NoOptDefVal == "",
+	}, true
+}
+
+// unitCompletions adds the completions provided by a Completer Config Unit.
+func (g *Group) unitCompletions(c Config, completions map[string]Completion) {
+	cp, ok := c.(Completer)
+	if !ok {
+		return
+	}
+	ns := g.flagNamespace(c)
+	for name, completion := range cp.Completions() {
+		if ns != "" {
+			name = ns + "." + name
+		}
+		completions[name] = completion
+	}
+}
+
+// completionCommands returns the root command followed by all registered
+// subcommands, including the intermediate levels of nested subcommands, in
+// order of registration.
+func (g *Group) completionCommands(root *completionCommand) []*completionCommand {
+	var (
+		cmds  = []*completionCommand{root}
+		index = map[string]*completionCommand{"": root}
+		help  = make(map[string]string)
+	)
+	for _, cmd := range g.cmds {
+		help[cmd.name] = cmd.helpText
+	}
+	for _, cmd := range g.cmds {
+		parts := strings.Fields(cmd.name)
+		for idx := range parts {
+			p := strings.Join(parts[:idx+1], " ")
+			if _, ok := index[p]; ok {
+				continue
+			}
+			node := &completionCommand{path: p}
+			index[p], cmds = node, append(cmds, node)
+			parent := index[strings.Join(parts[:idx], " ")]
+			parent.children = append(parent.children,
+				command{name: parts[idx], helpText: help[p]})
+		}
+		node := index[cmd.name]
+		node.flags = append(node.flags, g.commandFlags(cmd, node.flags)...)
+	}
+	return cmds
+}
+
+// commandFlags returns the completion details of the flags of the Config
+// Units of a subcommand that are not already accepted by the Group or listed
+// in seen.
+func (g *Group) commandFlags(cmd command, seen []completionFlag) []completionFlag {
+	var flags []completionFlag
+	known := func(name string) bool {
+		if g.f.Lookup(name) != nil {
+			return true
+		}
+		for _, f := range append(seen, flags...) {
+			if f.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+	for _, u := range cmd.units {
+		c, ok := u.(Config)
+		if !ok {
+			continue
+		}
+		fs := c.FlagSet()
+		if fs == nil {
+			continue
+		}
+		if ns := g.flagNamespace(c); ns != "" {
+			fs, _ = fs.namespaced(ns)
+		}
+		completions := fs.ruleCompletions()
+		g.unitCompletions(c, completions)
+		fs.VisitAll(func(f *pflag.Flag) {
+			if known(f.Name) {
+				return
+			}
+			if cf, ok := newCompletionFlag(f, completions); ok {
+				flags = append(flags, cf)
+			}
+		})
+	}
+	return flags
+}
+
+// writeBashFlagCases writes the value completion cases of the flags and
+// returns the words completing the flag names.
+func writeBashFlagCases(w io.Writer, indent string, flags []completionFlag) []string {
+	var words []string
+	fmt.Fprintf(w, "%scase \"${prev}\" in\n", indent)
+	for _, f := range flags {
+		words = append(words, "--"+f.Name)
+		if f.Shorthand != "" {
+			words = append(words, "-"+f.Shorthand)
+		}
+		if !f.hasValue {
+			continue
+		}
+		pattern := "--" + f.Name
+		if f.Shorthand != "" {
+			pattern += "|-" + f.Shorthand
+		}
+		fmt.Fprintf(w, "%s\t%s)\n", indent, pattern)
+		switch c := f.completion; {
+		case len(c.Values) > 0:
+			fmt.Fprintf(w, "%s\t\tCOMPREPLY=( $(compgen -W %s -- \"${cur}\") )\n",
+				indent, shellQuote(strings.Join(c.Values, " ")))
+		case c.Dirs:
+			fmt.Fprintf(w, "%s\t\tCOMPREPLY=( $(compgen -d -- \"${cur}\") )\n", indent)
+		case c.Files && len(c.Extensions) == 1:
+			fmt.Fprintf(w, "%s\t\tCOMPREPLY=( $(compgen -f -X %s -- \"${cur}\") )\n",
+				indent, shellQuote("!*."+c.Extensions[0]))
+		case c.Files && len(c.Extensions) > 1:
+			fmt.Fprintf(w, "%s\t\tCOMPREPLY=( $(compgen -f -X %s -- \"${cur}\") )\n",
+				indent, shellQuote("!*.@("+strings.Join(c.Extensions, "|")+")"))
+		case c.Files:
+			fmt.Fprintf(w, "%s\t\tCOMPREPLY=( $(compgen -f -- \"${cur}\") )\n", indent)
+		default:
+			fmt.Fprintf(w, "%s\t\tCOMPREPLY=()\n", indent)
+		}
+		fmt.Fprintf(w, "%s\t\treturn\n%s\t\t;;\n", indent, indent)
+	}
+	fmt.Fprintf(w, "%sesac\n", indent)
+	return words
+}
+
+func writeBashCompletion(w io.Writer, bin, fn string, cmds []*completionCommand) {
+	fmt.Fprintf(w, "# bash completion for %s\n", bin)
+	fmt.Fprintf(w, "%s() {\n", fn)
+	fmt.Fprintf(w, "\tlocal cur prev cmd word words i\n")
+	fmt.Fprintf(w, "\tcur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	fmt.Fprintf(w, "\tprev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	if len(cmds) > 1 {
+		// find the selected subcommand, skipping flags and flag values
+		paths := make([]string, 0, len(cmds)-1)
+		for _, cmd := range cmds[1:] {
+			paths = append(paths, shellQuote(cmd.path))
+		}
+		fmt.Fprintf(w, "\tcmd=\"\"\n")
+		fmt.Fprintf(w, "\tfor ((i=1; i<COMP_CWORD; i++)); do\n")
+		fmt.Fprintf(w, "\t\tword=\"${cmd:+${cmd} }${COMP_WORDS[i]}\"\n")
+		fmt.Fprintf(w, "\t\tcase \"${word}\" in\n")
+		fmt.Fprintf(w, "\t\t\t%s)\n\t\t\t\tcmd=\"${word}\"\n\t\t\t\t;;\n", strings.Join(paths, "|"))
+		fmt.Fprintf(w, "\t\tesac\n")
+		fmt.Fprintf(w, "\tdone\n")
+	}
+	words := writeBashFlagCases(w, "\t", cmds[0].flags)
+	fmt.Fprintf(w, "\twords=%s\n", shellQuote(strings.Join(words, " ")))
+	if len(cmds) == 1 {
+		fmt.Fprintf(w, "\tCOMPREPLY=( $(compgen -W \"${words}\" -- \"${cur}\") )\n")
+		fmt.Fprintf(w, "}\n")
+		fmt.Fprintf(w, "complete -o default -F %s %s\n", fn, bin)
+		return
+	}
+	fmt.Fprintf(w, "\tcase \"${cmd}\" in\n")
+	for _, cmd := range cmds {
+		fmt.Fprintf(w, "\t\t%s)\n", shellQuote(cmd.path))
+		var words []string
+		if cmd.path != "" {
+			words = writeBashFlagCases(w, "\t\t\t", cmd.flags)
+		}
+		for _, child := range cmd.children {
+			words = append(words, child.name)
+		}
+		if len(words) > 0 {
+			fmt.Fprintf(w, "\t\t\twords=\"${words} \"%s\n", shellQuote(strings.Join(words, " ")))
+		}
+		fmt.Fprintf(w, "\t\t\t;;\n")
+	}
+	fmt.Fprintf(w, "\tesac\n")
+	fmt.Fprintf(w, "\tCOMPREPLY=( $(compgen -W \"${words}\" -- \"${cur}\") )\n")
+	fmt.Fprintf(w, "}\n")
+	fmt.Fprintf(w, "complete -o default -F %s %s\n", fn, bin)
+}
+
+// zshSpecs returns the _arguments specs of the flags.
+func zshSpecs(flags []completionFlag) []string {
+	specs := make([]string, 0, len(flags))
+	for _, f := range flags {
+		usage := zshEscape(firstLine(f.Usage))
+		spec := "'--" + f.Name + "[" + usage + "]"
+		if f.Shorthand != "" {
+			spec = "'(-" + f.Shorthand + " --" + f.Name + ")'{-" + f.Shorthand +
+				",--" + f.Name + "}'[" + usage + "]"
+		}
+		if f.hasValue {
+			spec += ":" + zshEscape(f.Value.Type()) + ":"
+			switch c := f.completion; {
+			case len(c.Values) > 0:
+				values := make([]string, 0, len(c.Values))
+				for _, v := range c.Values {
+					values = append(values, zshEscape(v))
+				}
+				spec += "(" + strings.Join(values, " ") + ")"
+			case c.Dirs:
+				spec += "_files -/"
+			case c.Files && len(c.Extensions) > 0:
+				spec += "_files -g \"*.(" + strings.Join(c.Extensions, "|") + ")\""
+			case c.Files:
+				spec += "_files"
+			}
+		}
+		specs = append(specs, spec+"'")
+	}
+	return specs
+}
+
+// zshFunc returns the name of the zsh function completing a subcommand.
+func zshFunc(fn string, cmd *completionCommand) string {
+	if cmd.path == "" {
+		return fn
+	}
+	return fn + "_" + nonIdentifier.ReplaceAllString(strings.Join(cmd.words(), "_"), "_")
+}
+
+func writeZshCompletion(w io.Writer, bin, fn string, cmds []*completionCommand) {
+	fmt.Fprintf(w, "#compdef %s\n", bin)
+	global := zshSpecs(cmds[0].flags)
+	// each subcommand level has its own function, the Common Service options
+	// and Group flags are accepted at every level
+	for _, cmd := range cmds {
+		specs := global
+		if cmd.path != "" {
+			specs = append(append([]string(nil), global...), zshSpecs(cmd.flags)...)
+		}
+		fmt.Fprintf(w, "\n%s() {\n", zshFunc(fn, cmd))
+		if len(cmd.children) == 0 {
+			fmt.Fprintf(w, "\t_arguments -s")
+			for _, spec := range specs {
+				fmt.Fprintf(w, " \\\n\t\t%s", spec)
+			}
+			fmt.Fprintf(w, "\n}\n")
+			continue
+		}
+		names := make([]string, 0, len(cmd.children))
+		for _, child := range cmd.children {
+			names = append(names, zshEscape(child.name))
+		}
+		fmt.Fprintf(w, "\tlocal curcontext=\"$curcontext\" state line\n")
+		fmt.Fprintf(w, "\t_arguments -C -s")
+		for _, spec := range specs {
+			fmt.Fprintf(w, " \\\n\t\t%s", spec)
+		}
+		fmt.Fprintf(w, " \\\n\t\t'1:command:(%s)'", strings.Join(names, " "))
+		fmt.Fprintf(w, " \\\n\t\t'*::arg:->args'\n")
+		fmt.Fprintf(w, "\tcase $state in\n\t\targs)\n\t\t\tcase $words[1] in\n")
+		for _, child := range cmd.children {
+			childPath := strings.TrimSpace(cmd.path + " " + child.name)
+			fmt.Fprintf(w, "\t\t\t\t%s)\n\t\t\t\t\t%s\n\t\t\t\t\t;;\n",
+				shellQuote(child.name), zshFunc(fn, &completionCommand{path: childPath}))
+		}
+		fmt.Fprintf(w, "\t\t\tesac\n\t\t\t;;\n\tesac\n}\n")
+	}
+	fmt.Fprintf(w, "\nif [ \"$funcstack[1]\" = \"%s\" ]; then\n", fn)
+	fmt.Fprintf(w, "\t%s \"$@\"\nelse\n\tcompdef %s %s\nfi\n", fn, fn, bin)
+}
+
+// fishCondition returns the condition under which the completions of a
+// subcommand apply.
+func fishCondition(cmd *completionCommand) string {
+	var conds []string
+	for _, word := range cmd.words() {
+		conds = append(conds, "__fish_seen_subcommand_from "+word)
+	}
+	return strings.Join(conds, "; and ")
+}
+
+func writeFishCompletion(w io.Writer, bin string, cmds []*completionCommand) {
+	fmt.Fprintf(w, "# fish completion for %s\n", bin)
+	for _, cmd := range cmds {
+		cond := fishCondition(cmd)
+		for _, f := range cmd.flags {
+			line := "complete -c " + bin
+			if cond != "" {
+				line += " -n " + fishQuote(cond)
+			}
+			if f.Shorthand != "" {
+				line += " -s " + f.Shorthand
+			}
+			line += " -l " + f.Name + " -d " + fishQuote(firstLine(f.Usage))
+			if f.hasValue {
+				line += " -r"
+				switch c := f.completion; {
+				case len(c.Values) > 0:
+					line += " -f -a " + fishQuote(strings.Join(c.Values, " "))
+				case c.Dirs:
+					line += " -f -a '(__fish_complete_directories)'"
+				case c.Files && len(c.Extensions) > 0:
+					var suffixes []string
+					for _, ext := range c.Extensions {
+						suffixes = append(suffixes, "(__fish_complete_suffix ."+ext+")")
+					}
+					line += " -f -a " + fishQuote(strings.Join(suffixes, " "))
+				case c.Files:
+					line += " -F"
+				default:
+					line += " -f"
+				}
+			}
+			fmt.Fprintln(w, line)
+		}
+		for _, child := range cmd.children {
+			childCond := "__fish_use_subcommand"
+			if cond != "" {
+				childCond = fishQuote(cond + "; and not __fish_seen_subcommand_from " + child.name)
+			}
+			fmt.Fprintf(w, "complete -c %s -n %s -f -a %s -d %s\n",
+				bin, childCond, fishQuote(child.name), fishQuote(firstLine(child.helpText)))
+		}
+	}
+}
+
+func firstLine(s string) string {
+	return strings.SplitN(strings.TrimSpace(s), "\n", 2)[0]
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+func zshEscape(s string) string {
+	return strings.NewReplacer(
+		"'", `'\''`, "[", `\[`, "]", `\]`, ":", `\:`,
+	).Replace(s)
+}
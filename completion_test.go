@@ -0,0 +1,160 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/tetratelabs/telemetry"
+
+	"github.com/tetratelabs/run"
+)
+
+func TestCompletion(t *testing.T) {
+	for _, tt := range []struct {
+		shell string
+		want  []string
+	}{
+		{
+			shell: "bash",
+			want: []string{
+				"complete -o default -F _",
+				"--mode|-m)",
+				`compgen -W 'fast slow'`,
+				`compgen -f -X '!*.@(yaml|yml)'`,
+				"--dir)\n\t\t\tCOMPREPLY=( $(compgen -d",
+				"serve migrate",
+				"\t\t'migrate up')\n\t\t\tcase \"${prev}\" in\n\t\t\t\t--steps)",
+				"words=\"${words} \"'--port'",
+				"'serve'|'migrate'|'migrate up')",
+			},
+		},
+		{
+			shell: "zsh",
+			want: []string{
+				"#compdef ",
+				`'(-m --mode)'{-m,--mode}'[operating mode]:string:(fast slow)'`,
+				`'--file[config file]:string:_files -g "*.(yaml|yml)"'`,
+				`'--dir[data dir]:string:_files -/'`,
+				`'1:command:(serve migrate)'`,
+				"_migrate_up() {\n\t_arguments -s",
+				`'--steps[number of migrations]:int:'`,
+				"\t\t\t\t'up')\n\t\t\t\t\t_",
+			},
+		},
+		{
+			shell: "fish",
+			want: []string{
+				"-s m -l mode -d 'operating mode' -r -f -a 'fast slow'",
+				"-l dir -d 'data dir' -r -f -a '(__fish_complete_directories)'",
+				"-n __fish_use_subcommand -f -a 'migrate' -d 'run migrations'",
+				"-n '__fish_seen_subcommand_from migrate; and not __fish_seen_subcommand_from up' -f -a 'up' -d 'run up migrations'",
+				"-n '__fish_seen_subcommand_from migrate; and __fish_seen_subcommand_from up' -l steps -d 'number of migrations' -r -f",
+				"-n '__fish_seen_subcommand_from serve' -l port",
+			},
+		},
+	} {
+		g := run.Group{Logger: telemetry.NoopLogger()}
+		g.Register(&completerConfig{})
+		g.RegisterCommand("serve", "start the server", &intFlagConfig{name: "port", usage: "listen port"})
+		g.RegisterCommand("migrate", "run migrations")
+		g.RegisterCommand("migrate up", "run up migrations", &intFlagConfig{name: "steps", usage: "number of migrations"})
+
+		var err error
+		have := captureStdout(t, func() {
+			err = g.RunConfig("--completion", tt.shell)
+		})
+		if err != run.ErrBailEarlyRequest {
+			t.Errorf("%s: expected bail early request, got %v", tt.shell, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(have, want) {
+				t.Errorf("%s: expected script to contain %q:\n%s", tt.shell, want, have)
+			}
+		}
+		if strings.Contains(have, "--completion") {
+			t.Errorf("%s: expected hidden flags to be omitted:\n%s", tt.shell, have)
+		}
+	}
+
+	g := run.Group{Logger: telemetry.NoopLogger()}
+	if err := g.RunConfig("--completion", "cmd.exe"); !errors.Is(err, run.ErrUnsupportedShell) {
+		t.Errorf("expected unsupported shell error, got %v", err)
+	}
+}
+
+type completerConfig struct {
+	mode, file, dir string
+}
+
+func (c completerConfig) Name() string { return "completer" }
+
+func (c *completerConfig) FlagSet() *run.FlagSet {
+	flags := run.NewFlagSet("completer config")
+	flags.StringVarP(&c.mode, "mode", "m", "fast", "operating mode")
+	flags.StringVar(&c.file, "file", "", "config file")
+	flags.StringVar(&c.dir, "dir", "", "data dir")
+	return flags
+}
+
+func (c completerConfig) Validate() error { return nil }
+
+func (c completerConfig) Completions() map[string]run.Completion {
+	return map[string]run.Completion{
+		"mode": {Values: []string{"fast", "slow"}},
+		"file": {Files: true, Extensions: []string{"yaml", "yml"}},
+		"dir":  {Dirs: true},
+	}
+}
+
+// intFlagConfig is a Config Unit with a single int flag.
+type intFlagConfig struct {
+	name, usage string
+	value       int
+}
+
+func (c intFlagConfig) Name() string { return c.name }
+
+func (c *intFlagConfig) FlagSet() *run.FlagSet {
+	flags := run.NewFlagSet(c.name + " config")
+	flags.IntVar(&c.value, c.name, 0, c.usage)
+	return flags
+}
+
+func (c intFlagConfig) Validate() error { return nil }
+
+// captureStdout returns everything written to os.Stdout while running fn.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("unable to create pipe: %v", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+	defer func() { os.Stdout = stdout }()
+	fn()
+	_ = w.Close()
+	return <-out
+}
@@ -0,0 +1,480 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/tetratelabs/multierror"
+)
+
+// Reloader is an extension interface that Config Units can implement to opt in
+// to runtime configuration reloading when Group watches its config file (see
+// Group.ConfigReloadInterval).
+//
+// When the config file changes values of flags owned by a Reloader, Group
+// parses the new values into staging copies of the changed flags, checks the
+// rules of the Unit's FlagSet against them and calls Reload with the staged
+// flags. Group does not touch the Unit's flag backed fields, nor does it call
+// Validate, as the Unit is serving at this point. It is up to Reload to
+// validate the new values and apply them, under the Unit's own lock, or to
+// reject the change by returning an error. If any of the affected Reloaders
+// reject the change, the Reloaders that already accepted it are called again
+// with the previous values. Changes to flags not owned by a Reloader are
+// rejected as they require a restart.
+//
+// Reload is called from the Group's config watcher goroutine, concurrently with
+// the Unit's Serve or ServeContext method.
+type Reloader interface {
+	Config
+	Reload(change ConfigChange) error
+}
+
+// ConfigChange holds the changed flags of a Reloader, keyed by the flag names
+// as registered in the Unit's FlagSet.
+type ConfigChange struct {
+	// Flags holds staging copies of the changed flags holding their new
+	// values. Use its typed getters, e.g. Flags.GetInt("workers"), to
+	// retrieve them.
+	Flags *FlagSet
+	// Previous and Current hold the string representations of the previous
+	// and new values of the changed flags.
+	Previous, Current map[string]string
+}
+
+// ErrConfigFile is returned when the config file can't be read or holds
+// invalid entries.
+const ErrConfigFile Error = "invalid config file"
+
+// configEntries holds the raw values found in a config file keyed by flag name.
+// A key can hold multiple values to allow for slice flags.
+type configEntries map[string][]string
+
+// readConfigFile reads the config file at the provided path. The config file
+// holds one "flag-name = value" entry per line, using the flag names as found
+// in the Group's merged FlagSet (so including namespaces). Empty lines and
+// lines starting with '#' are ignored. Values can be double quoted. Repeating
+// an entry provides multiple values for slice flags.
+func readConfigFile(path string) (configEntries, []byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrConfigFile, err)
+	}
+	entries := make(configEntries)
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for lineNr := 1; scanner.Scan(); lineNr++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, nil, fmt.Errorf("%w: %s:%d: expected \"flag-name = value\"",
+				ErrConfigFile, path, lineNr)
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if len(value) > 1 && value[0] == '"' {
+			if value, err = strconv.Unquote(value); err != nil {
+				return nil, nil, fmt.Errorf("%w: %s:%d: %v", ErrConfigFile, path, lineNr, err)
+			}
+		}
+		entries[key] = append(entries[key], value)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrConfigFile, err)
+	}
+	return entries, b, nil
+}
+
+// flagSnapshot holds the value of a flag so it can be restored.
+type flagSnapshot struct {
+	flag  *pflag.Flag
+	value string
+	slice []string
+}
+
+func snapshotFlag(f *pflag.Flag) flagSnapshot {
+	s := flagSnapshot{flag: f, value: f.Value.String()}
+	if sv, ok := f.Value.(pflag.SliceValue); ok {
+		s.slice = append([]string{}, sv.GetSlice()...)
+	}
+	return s
+}
+
+func (s flagSnapshot) restore() error {
+	if sv, ok := s.flag.Value.(pflag.SliceValue); ok {
+		return sv.Replace(s.slice)
+	}
+	return s.flag.Value.Set(s.value)
+}
+
+// stagingValues holds constructors of empty Values for the flag types
+// supporting runtime reloading.
+var stagingValues = map[string]func(fs *pflag.FlagSet){
+	"bool":           func(fs *pflag.FlagSet) { fs.Bool("v", false, "") },
+	"duration":       func(fs *pflag.FlagSet) { fs.Duration("v", 0, "") },
+	"float32":        func(fs *pflag.FlagSet) { fs.Float32("v", 0, "") },
+	"float64":        func(fs *pflag.FlagSet) { fs.Float64("v", 0, "") },
+	"int":            func(fs *pflag.FlagSet) { fs.Int("v", 0, "") },
+	"int32":          func(fs *pflag.FlagSet) { fs.Int32("v", 0, "") },
+	"int64":          func(fs *pflag.FlagSet) { fs.Int64("v", 0, "") },
+	"uint":           func(fs *pflag.FlagSet) { fs.Uint("v", 0, "") },
+	"uint32":         func(fs *pflag.FlagSet) { fs.Uint32("v", 0, "") },
+	"uint64":         func(fs *pflag.FlagSet) { fs.Uint64("v", 0, "") },
+	"string":         func(fs *pflag.FlagSet) { fs.String("v", "", "") },
+	"stringArray":    func(fs *pflag.FlagSet) { fs.StringArray("v", nil, "") },
+	"stringSlice":    func(fs *pflag.FlagSet) { fs.StringSlice("v", nil, "") },
+	"intSlice":       func(fs *pflag.FlagSet) { fs.IntSlice("v", nil, "") },
+	"durationSlice":  func(fs *pflag.FlagSet) { fs.DurationSlice("v", nil, "") },
+	"stringToString": func(fs *pflag.FlagSet) { fs.StringToString("v", nil, "") },
+}
+
+// stageFlag returns a copy of the flag holding the provided values, without
+// touching the original flag and the variable backing it.
+func stageFlag(f *pflag.Flag, values []string, changed bool) (*pflag.Flag, error) {
+	newValue, ok := stagingValues[f.Value.Type()]
+	if !ok {
+		return nil, fmt.Errorf("flags of type %s can't be changed at runtime", f.Value.Type())
+	}
+	fs := pflag.NewFlagSet("staging", pflag.ContinueOnError)
+	newValue(fs)
+	staged := *f
+	staged.Value, staged.Changed = fs.Lookup("v").Value, changed
+	if s, ok := f.Value.(secret); ok {
+		// allow the new secret values to be redacted
+		s.secret().record(values...)
+	}
+	if err := setFlag(&staged, values); err != nil {
+		return nil, err
+	}
+	return &staged, nil
+}
+
+// setFlag sets the provided config file values on the flag.
+func setFlag(f *pflag.Flag, values []string) error {
+	if sv, ok := f.Value.(pflag.SliceValue); ok {
+		return sv.Replace(values)
+	}
+	for _, v := range values {
+		if err := f.Value.Set(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyConfigFile sets the values found in the config file on the flags that
+// were not provided on the command line.
+func (g *Group) applyConfigFile(entries configEntries) error {
+	var errs []string
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		f := g.f.Lookup(key)
+		if f == nil || key == "config-file" {
+			errs = append(errs, fmt.Sprintf("unknown flag %q", key))
+			continue
+		}
+		if f.Changed {
+			// command line arguments take precedence over the config file
+			continue
+		}
+		if err := setFlag(f, entries[key]); err != nil {
+			errs = append(errs, fmt.Sprintf("invalid value for %q: %v", key, err))
+			continue
+		}
+		f.Changed = true
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %s", ErrConfigFile, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// loadConfigFile applies the config file to the flags not provided on the
+// command line and prepares the config watcher if requested.
+func (g *Group) loadConfigFile() error {
+	entries, b, err := readConfigFile(g.opts.configFile)
+	if err != nil {
+		return err
+	}
+	cli := make(map[string]bool)
+	g.f.Visit(func(f *pflag.Flag) { cli[g.aliasTarget(f.Name)] = true })
+	if err = g.applyConfigFile(entries); err != nil {
+		return err
+	}
+	if g.ConfigReloadInterval <= 0 {
+		return nil
+	}
+	fi, err := os.Stat(g.opts.configFile)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrConfigFile, err)
+	}
+	g.watcher = &configWatcher{
+		g:        g,
+		path:     g.opts.configFile,
+		interval: g.ConfigReloadInterval,
+		cli:      cli,
+		applied:  g.canonicalEntries(entries),
+		modTime:  fi.ModTime(),
+		size:     fi.Size(),
+		sum:      sha256.Sum256(b),
+	}
+	return nil
+}
+
+// configWatcher is a ServiceContext polling the config file for changes and
+// re-applying the values of changed flags at runtime.
+type configWatcher struct {
+	g        *Group
+	path     string
+	interval time.Duration
+	cli      map[string]bool
+	applied  configEntries
+	modTime  time.Time
+	size     int64
+	sum      [sha256.Size]byte
+	pending  struct {
+		modTime time.Time
+		size    int64
+	}
+}
+
+func (c *configWatcher) Name() string {
+	return "config-watcher"
+}
+
+func (c *configWatcher) ServeContext(ctx context.Context) error {
+	t := time.NewTicker(c.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			c.poll()
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// poll checks the config file for changes and reloads it if needed.
+func (c *configWatcher) poll() {
+	fi, err := os.Stat(c.path)
+	if err != nil {
+		c.g.Logger.Error("config reload", c.g.redact(err), "path", c.path)
+		return
+	}
+	if fi.ModTime().Equal(c.modTime) && fi.Size() == c.size {
+		return
+	}
+	if !fi.ModTime().Equal(c.pending.modTime) || fi.Size() != c.pending.size {
+		// wait for the file to settle before reading it, so we don't act on
+		// partially written files
+		c.pending.modTime, c.pending.size = fi.ModTime(), fi.Size()
+		return
+	}
+	c.modTime, c.size = fi.ModTime(), fi.Size()
+	entries, b, err := readConfigFile(c.path)
+	if err != nil {
+		c.g.Logger.Error("config reload", c.g.redact(err), "path", c.path)
+		return
+	}
+	sum := sha256.Sum256(b)
+	if sum == c.sum {
+		return
+	}
+	c.sum = sum
+	if err = c.reload(c.g.canonicalEntries(entries)); err != nil {
+		c.g.Logger.Error("config reload rejected", c.g.redact(err), "path", c.path)
+		return
+	}
+}
+
+// reload applies the changed config file entries in an all or nothing fashion.
+func (c *configWatcher) reload(entries configEntries) (err error) {
+	type owner struct {
+		idx      int
+		prefix   string
+		changed  []string
+		apply    ConfigChange
+		rollback ConfigChange
+	}
+	var (
+		g       = c.g
+		owners  []*owner
+		byIdx   = make(map[int]*owner)
+		changed []string
+		staged  = make(map[string][2]*pflag.Flag)
+	)
+
+	// find the changed flags and the Config Units owning them
+	keys := make(map[string]bool)
+	for key := range entries {
+		keys[key] = true
+	}
+	for key := range c.applied {
+		keys[key] = true
+	}
+	for key := range keys {
+		if c.cli[key] || equalValues(entries[key], c.applied[key]) {
+			continue
+		}
+		if g.f.Lookup(key) == nil || key == "config-file" {
+			return fmt.Errorf("%w: unknown flag %q", ErrConfigFile, key)
+		}
+		changed = append(changed, key)
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	sort.Strings(changed)
+	for _, key := range changed {
+		idx := g.flagOwner(key)
+		if idx == -1 {
+			return fmt.Errorf("flag %q can't be changed at runtime", key)
+		}
+		if _, ok := g.c[idx].(Reloader); !ok {
+			return fmt.Errorf("flag %q can't be changed at runtime: unit %s does not support reloading",
+				key, g.c[idx].Name())
+		}
+		o, ok := byIdx[idx]
+		if !ok {
+			o = &owner{idx: idx}
+			if ns := g.flagNamespace(g.c[idx]); ns != "" {
+				o.prefix = ns + "."
+			}
+			byIdx[idx] = o
+			owners = append(owners, o)
+		}
+		o.changed = append(o.changed, key)
+	}
+	sort.Slice(owners, func(i, j int) bool { return owners[i].idx < owners[j].idx })
+
+	// parse the previous and new values into staging copies of the flags
+	for _, key := range changed {
+		f := g.f.Lookup(key)
+		values := entries[key]
+		if values == nil {
+			// entry was removed from the config file, restore the default
+			values = []string{f.DefValue}
+			if _, ok := f.Value.(pflag.SliceValue); ok {
+				values = parseDefaultSlice(f.DefValue)
+			}
+		}
+		current, sErr := stageFlag(f, values, entries[key] != nil)
+		if sErr != nil {
+			return fmt.Errorf("%w: invalid value for %q: %v", ErrConfigFile, key, sErr)
+		}
+		previous, sErr := stageFlag(f, flagValues(f), f.Changed)
+		if sErr != nil {
+			return fmt.Errorf("%w: invalid value for %q: %v", ErrConfigFile, key, sErr)
+		}
+		staged[key] = [2]*pflag.Flag{previous, current}
+	}
+
+	// check the rules of the affected FlagSets against the new values
+	for _, o := range owners {
+		fs := NewFlagSet(g.fs[o.idx].Name)
+		fs.rules = g.fs[o.idx].rules
+		g.fs[o.idx].VisitAll(func(f *pflag.Flag) {
+			if s, ok := staged[f.Name]; ok {
+				f = s[1]
+			}
+			fs.AddFlag(f)
+		})
+		if rErrs := fs.checkRules(); len(rErrs) > 0 {
+			return fmt.Errorf("validate %s: %w", g.c[o.idx].Name(), multierror.Append(nil, rErrs...))
+		}
+	}
+
+	// hand the staged values to the Reloaders, rolling back on rejection
+	for _, o := range owners {
+		o.apply = ConfigChange{Flags: NewFlagSet(g.c[o.idx].Name()),
+			Previous: make(map[string]string), Current: make(map[string]string)}
+		o.rollback = ConfigChange{Flags: NewFlagSet(g.c[o.idx].Name()),
+			Previous: o.apply.Current, Current: o.apply.Previous}
+		for _, key := range o.changed {
+			name := strings.TrimPrefix(key, o.prefix)
+			for idx, change := range []ConfigChange{o.rollback, o.apply} {
+				f := *staged[key][idx]
+				f.Name = name
+				change.Flags.AddFlag(&f)
+			}
+			o.apply.Previous[name] = staged[key][0].Value.String()
+			o.apply.Current[name] = staged[key][1].Value.String()
+		}
+	}
+	var accepted []*owner
+	for _, o := range owners {
+		if err = g.c[o.idx].(Reloader).Reload(o.apply); err != nil {
+			for _, a := range accepted {
+				if rErr := g.c[a.idx].(Reloader).Reload(a.rollback); rErr != nil {
+					g.Logger.Error("config rollback", g.redact(rErr), "name", g.c[a.idx].Name())
+				}
+			}
+			return fmt.Errorf("reload %s: %w", g.c[o.idx].Name(), err)
+		}
+		accepted = append(accepted, o)
+	}
+
+	c.applied = entries
+	g.Logger.Info("config reloaded", "path", c.path, "flags", strings.Join(changed, ","))
+	return nil
+}
+
+// flagOwner returns the index of the Config Unit owning the flag or -1 if the
+// flag is not owned by a Config Unit.
+func (g *Group) flagOwner(name string) int {
+	for idx, fs := range g.fs {
+		if fs != nil && g.c[idx] != nil && fs.Lookup(name) != nil {
+			return idx
+		}
+	}
+	return -1
+}
+
+func equalValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+// parseDefaultSlice returns the values of a slice flag's default value.
+func parseDefaultSlice(s string) []string {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
@@ -0,0 +1,286 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+
+	"github.com/tetratelabs/run"
+	"github.com/tetratelabs/run/pkg/test"
+)
+
+func TestConfigFile(t *testing.T) {
+	var (
+		cfg  = filepath.Join(t.TempDir(), "config")
+		unit reloadConfig
+		g    = run.Group{EnableConfigFile: true, Logger: telemetry.NoopLogger()}
+	)
+	writeFile(t, cfg, "# comment\naddr = \"localhost:80\"\n\nworkers = 5\n")
+
+	g.Register(&unit)
+	if err := g.Run("--config-file", cfg, "--workers", "3"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want, have := "localhost:80", unit.addr; want != have {
+		t.Errorf("addr: want %q, have %q", want, have)
+	}
+	if want, have := 3, unit.workers; want != have {
+		t.Errorf("workers: want %d, have %d", want, have)
+	}
+
+	for _, content := range []string{
+		"unknown = 1\n",
+		"workers = five\n",
+		"workers\n",
+	} {
+		writeFile(t, cfg, content)
+		g = run.Group{EnableConfigFile: true, Logger: telemetry.NoopLogger()}
+		g.Register(&reloadConfig{})
+		if err := g.Run("--config-file", cfg); !errors.Is(err, run.ErrConfigFile) {
+			t.Errorf("%q: expected config file error, got %v", content, err)
+		}
+	}
+}
+
+func TestConfigReload(t *testing.T) {
+	var (
+		cfg  = filepath.Join(t.TempDir(), "config")
+		unit = reloadConfig{reloads: make(chan map[string]string, 5)}
+		irq  = make(chan error)
+		res  = make(chan error)
+		ok   = make(chan struct{})
+		g    = run.Group{
+			EnableConfigFile:     true,
+			ConfigReloadInterval: 5 * time.Millisecond,
+			Logger:               telemetry.NoopLogger(),
+		}
+	)
+	writeFile(t, cfg, "addr = localhost:80\n")
+
+	g.Register(&unit, &test.TestSvc{
+		SvcName: "irqsvc",
+		Execute: func() error {
+			close(ok)
+			for {
+				select {
+				case err := <-irq:
+					return err
+				case <-time.After(time.Millisecond):
+					// read the reloadable values like a serving Unit would
+					_, _ = unit.values()
+				}
+			}
+		},
+	})
+	go func() { res <- g.Run("--config-file", cfg) }()
+	defer func() {
+		irq <- run.ErrRequestedShutdown
+		if err := <-res; err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}()
+	<-ok
+
+	waitReload := func() map[string]string {
+		select {
+		case m := <-unit.reloads:
+			return m
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for reload")
+			return nil
+		}
+	}
+
+	// accepted change
+	writeFile(t, cfg, "addr = localhost:8080\n")
+	if want, have := "localhost:8080", waitReload()["addr"]; want != have {
+		t.Errorf("reload: want %q, have %q", want, have)
+	}
+
+	// rejected by Reload: nothing applied
+	writeFile(t, cfg, "addr = reject\nworkers = 2\n")
+	if want, have := "reject", waitReload()["addr"]; want != have {
+		t.Errorf("reload: want %q, have %q", want, have)
+	}
+	if addr, workers := unit.values(); addr != "localhost:8080" || workers != 1 {
+		t.Errorf("unexpected values after rejected reload: %q, %d", addr, workers)
+	}
+
+	// rejected by Reload validation
+	writeFile(t, cfg, "addr = \"\"\n")
+	// non-reloadable flag: rejected
+	writeFile(t, cfg, "name = other\naddr = localhost:9090\n")
+	// removed entry: back to default
+	writeFile(t, cfg, "workers = 4\n")
+	m := waitReload()
+	if want, have := "localhost", m["addr"]; want != have {
+		t.Errorf("reload: want %q, have %q", want, have)
+	}
+	if want, have := "4", m["workers"]; want != have {
+		t.Errorf("reload: want %q, have %q", want, have)
+	}
+	if addr, workers := unit.values(); addr != "localhost" || workers != 4 {
+		t.Errorf("unexpected values after reload: %q, %d", addr, workers)
+	}
+}
+
+func TestConfigReloadRollback(t *testing.T) {
+	var (
+		cfg     = filepath.Join(t.TempDir(), "config")
+		first   = levelConfig{changes: make(chan run.ConfigChange, 5)}
+		second  = reloadConfig{reloads: make(chan map[string]string, 5)}
+		irq     = make(chan error)
+		res     = make(chan error)
+		serving = make(chan struct{})
+		g       = run.Group{
+			EnableConfigFile:     true,
+			ConfigReloadInterval: 5 * time.Millisecond,
+			Logger:               telemetry.NoopLogger(),
+		}
+	)
+	writeFile(t, cfg, "level = 1\n")
+
+	g.Register(&first, &second, &test.TestSvc{
+		SvcName: "irqsvc",
+		Execute: func() error {
+			close(serving)
+			return <-irq
+		},
+	})
+	go func() { res <- g.Run("--config-file", cfg) }()
+	<-serving
+
+	writeFile(t, cfg, "level = 3\naddr = reject\n")
+	for _, want := range []string{"3", "1"} {
+		select {
+		case c := <-first.changes:
+			level, err := c.Flags.GetInt("level")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if have := c.Current["level"]; want != have || want != strconv.Itoa(level) {
+				t.Errorf("want level %s, have %q (%d)", want, have, level)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for reload")
+		}
+	}
+
+	irq <- run.ErrRequestedShutdown
+	if err := <-res; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+type levelConfig struct {
+	level   int
+	changes chan run.ConfigChange
+}
+
+func (l *levelConfig) Name() string { return "level" }
+
+func (l *levelConfig) FlagSet() *run.FlagSet {
+	flags := run.NewFlagSet("level config")
+	flags.IntVar(&l.level, "level", 0, "level")
+	return flags
+}
+
+func (l *levelConfig) Validate() error { return nil }
+
+func (l *levelConfig) Reload(change run.ConfigChange) error {
+	l.changes <- change
+	return nil
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path+".tmp", []byte(content), 0o600); err != nil {
+		t.Fatalf("unable to write file: %v", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		t.Fatalf("unable to rename file: %v", err)
+	}
+	// allow the config watcher to pick up each write
+	time.Sleep(20 * time.Millisecond)
+}
+
+type reloadConfig struct {
+	mu      sync.Mutex
+	addr    string
+	workers int
+	reloads chan map[string]string
+}
+
+func (r *reloadConfig) Name() string { return "reloader" }
+
+func (r *reloadConfig) FlagSet() *run.FlagSet {
+	flags := run.NewFlagSet("reload config")
+	flags.StringVar(&r.addr, "addr", "localhost", "address")
+	flags.IntVar(&r.workers, "workers", 1, "workers")
+	return flags
+}
+
+func (r *reloadConfig) Validate() error {
+	return validateAddr(r.addr)
+}
+
+func (r *reloadConfig) Reload(change run.ConfigChange) error {
+	addr, err := change.Flags.GetString("addr")
+	if err != nil {
+		// addr unchanged
+		r.mu.Lock()
+		addr = r.addr
+		r.mu.Unlock()
+	}
+	if err = validateAddr(addr); err != nil {
+		return err
+	}
+	if r.reloads != nil {
+		r.reloads <- change.Current
+	}
+	if addr == "reject" {
+		return errors.New("rejected")
+	}
+	workers, wErr := change.Flags.GetInt("workers")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.addr = addr
+	if wErr == nil {
+		r.workers = workers
+	}
+	return nil
+}
+
+func (r *reloadConfig) values() (string, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.addr, r.workers
+}
+
+func validateAddr(addr string) error {
+	if addr == "" {
+		return errors.New("missing addr")
+	}
+	return nil
+}
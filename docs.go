@@ -0,0 +1,282 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/tetratelabs/run/pkg/version"
+)
+
+// DocFormat holds the output format of generated reference documentation.
+type DocFormat string
+
+// Supported reference documentation formats.
+const (
+	DocMarkdown DocFormat = "markdown"
+	DocMan      DocFormat = "man"
+)
+
+// ErrUnsupportedDocFormat is returned when requesting reference documentation
+// in a format that is not supported.
+const ErrUnsupportedDocFormat Error = "unsupported documentation format"
+
+// WriteDocs writes reference documentation for the Group to w, in the
+// requested format. The documentation holds the Group's HelpText, the
+// registered subcommands and the flags of the Common Service options and all
+// Config Units, grouped per FlagSet. Hidden flags are only included if
+// requested.
+//
+// If RunConfig has not been called yet, WriteDocs runs the Initializer and
+// Namer phases and collects the FlagSets of the registered Config Units,
+// without parsing any arguments. The Group is reset afterwards, so a later
+// Run still runs the Config phase. This allows WriteDocs to be used from a
+// small go:generate helper:
+//
+//	//go:generate go run ./internal/gendocs
+//
+//	func main() {
+//	  g := run.Group{Name: "mytool"}
+//	  g.Register(units...)
+//	  f, _ := os.Create("docs/mytool.md")
+//	  defer f.Close()
+//	  if err := g.WriteDocs(f, run.DocMarkdown, false); err != nil {
+//	    log.Fatal(err)
+//	  }
+//	}
+//
+// The same output can be requested from a Group enabled binary through the
+// hidden --generate-docs flag, which accepts the format (markdown or man) and
+// can be combined with the hidden --generate-docs-hidden flag.
+func (g *Group) WriteDocs(w io.Writer, format DocFormat, includeHidden bool) error {
+	if g.f == nil {
+		defer g.registerFlagsOnly()()
+	}
+
+	var sets []*FlagSet
+	for _, fs := range append([]*FlagSet{g.gFS}, g.fs...) {
+		if fs != nil {
+			sets = append(sets, fs)
+		}
+	}
+
+	switch format {
+	case DocMarkdown:
+		g.writeMarkdown(w, sets, includeHidden)
+	case DocMan:
+		g.writeMan(w, sets, includeHidden)
+	default:
+		return fmt.Errorf("%w: %q (supported: %s, %s)",
+			ErrUnsupportedDocFormat, format, DocMarkdown, DocMan)
+	}
+	return nil
+}
+
+// registerFlagsOnly registers the flags of the Common Service options and all
+// Config Units outside of RunConfig, for generating documentation. The
+// returned function resets the Group to its unconfigured state, so a later
+// Run or RunConfig still parses its arguments, provides the LoggerSetter Units
+// with their Logger and initializes and validates the Units.
+func (g *Group) registerFlagsOnly() (reset func()) {
+	logger, name := g.Logger, g.Name
+	l := append([]LoggerSetter(nil), g.l...)
+	i := append([]Initializer(nil), g.i...)
+	_, _ = g.registerFlags([]string{})
+	return func() {
+		g.Logger, g.Name = logger, name
+		g.l, g.i = l, i
+		g.f, g.gFS, g.fs, g.cmd = nil, nil, nil, nil
+		g.opts = commonOptions{}
+		g.configured = false
+	}
+}
+
+// docDate returns the date to put in generated man pages. To keep generated
+// documentation reproducible, it is taken from $SOURCE_DATE_EPOCH and left
+// out if unset.
+func docDate() string {
+	epoch, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64)
+	if err != nil {
+		return ""
+	}
+	return time.Unix(epoch, 0).UTC().Format("January 2006")
+}
+
+// docFlags returns the flags of the FlagSet to document in order of
+// registration.
+func docFlags(fs *FlagSet, includeHidden bool) []*pflag.Flag {
+	var flags []*pflag.Flag
+	fs.VisitAll(func(f *pflag.Flag) {
+		if !f.Hidden || includeHidden {
+			flags = append(flags, f)
+		}
+	})
+	return flags
+}
+
+// flagDefault returns the default value of a flag if it is worth documenting.
+func flagDefault(f *pflag.Flag) string {
+	if zeroDefault(f) {
+		return ""
+	}
+	if isSecret(f) {
+		return redacted
+	}
+	return f.DefValue
+}
+
+// zeroDefault returns true if the flag's default value is its zero value.
+func zeroDefault(f *pflag.Flag) bool {
+	switch f.DefValue {
+	case "", "[]", "0", "0s":
+		return true
+	case "false":
+		return f.Value.Type() == "bool"
+	}
+	return false
+}
+
+// flagNotes returns the notes to add to a flag's documentation.
+func flagNotes(fs *FlagSet, f *pflag.Flag) []string {
+	notes := fs.ruleNotes(f.Name)
+	if isSecret(f) {
+		notes = append(notes, "secret")
+	}
+	if env := secretEnv(f); env != "" {
+		notes = append(notes, "env $"+env)
+	}
+	if f.Hidden {
+		notes = append(notes, "hidden")
+	}
+	if f.Deprecated != "" {
+		notes = append(notes, "deprecated: "+f.Deprecated)
+	}
+	return notes
+}
+
+func (g *Group) writeMarkdown(w io.Writer, sets []*FlagSet, includeHidden bool) {
+	fmt.Fprintf(w, "# %s\n\n", g.usageName())
+	if helpText := g.helpText(); helpText != "" {
+		fmt.Fprintf(w, "%s\n\n", strings.TrimSpace(helpText))
+	}
+	fmt.Fprintf(w, "## Usage\n\n```\n%s\n```\n\n", strings.TrimSpace(g.usageName()+" [flags] "+g.argsUsage()))
+
+	if g.cmd == nil && len(g.cmds) > 0 {
+		fmt.Fprintf(w, "## Commands\n\n| Command | Description |\n| --- | --- |\n")
+		for _, cmd := range g.cmds {
+			fmt.Fprintf(w, "| `%s` | %s |\n", cmd.name, markdownCell(firstLine(cmd.helpText)))
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "## Flags\n")
+	for _, fs := range sets {
+		flags := docFlags(fs, includeHidden)
+		if len(flags) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n### %s\n\n", fs.Name)
+		fmt.Fprintf(w, "| Flag | Type | Default | Description |\n| --- | --- | --- | --- |\n")
+		for _, f := range flags {
+			name := "`--" + f.Name + "`"
+			if f.Shorthand != "" {
+				name = "`-" + f.Shorthand + "`, " + name
+			}
+			varName, usage := pflag.UnquoteUsage(f)
+			def := flagDefault(f)
+			if def != "" {
+				def = "`" + markdownCell(def) + "`"
+			}
+			fmt.Fprintf(w, "| %s | %s | %s | %s |\n", name, varName, def,
+				markdownCell(withNotes(usage, flagNotes(fs, f))))
+		}
+	}
+}
+
+func (g *Group) writeMan(w io.Writer, sets []*FlagSet, includeHidden bool) {
+	title := strings.ToUpper(strings.ReplaceAll(g.usageName(), " ", "-"))
+	fmt.Fprintf(w, ".TH %s 1 \"%s\" \"%s\"\n", manEscape(title),
+		docDate(), manEscape(g.Name+" "+version.Parse()))
+	fmt.Fprintf(w, ".SH NAME\n%s\n", manEscape(g.usageName()))
+	fmt.Fprintf(w, ".SH SYNOPSIS\n\\fB%s\\fR [\\fIflags\\fR]", manEscape(g.usageName()))
+	if args := g.argsUsage(); args != "" {
+		fmt.Fprintf(w, " \\fI%s\\fR", manEscape(args))
+	}
+	fmt.Fprintln(w)
+	if helpText := g.helpText(); helpText != "" {
+		fmt.Fprintf(w, ".SH DESCRIPTION\n%s\n", manEscape(strings.TrimSpace(helpText)))
+	}
+
+	if g.cmd == nil && len(g.cmds) > 0 {
+		fmt.Fprintf(w, ".SH COMMANDS\n")
+		for _, cmd := range g.cmds {
+			fmt.Fprintf(w, ".TP\n\\fB%s\\fR\n%s\n", manEscape(cmd.name),
+				manEscape(firstLine(cmd.helpText)))
+		}
+	}
+
+	fmt.Fprintf(w, ".SH OPTIONS\n")
+	for _, fs := range sets {
+		flags := docFlags(fs, includeHidden)
+		if len(flags) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, ".SS %s\n", manEscape(fs.Name))
+		for _, f := range flags {
+			varName, usage := pflag.UnquoteUsage(f)
+			fmt.Fprintf(w, ".TP\n")
+			if f.Shorthand != "" {
+				fmt.Fprintf(w, "\\fB\\-%s\\fR, ", manEscape(f.Shorthand))
+			}
+			fmt.Fprintf(w, "\\fB\\-\\-%s\\fR", manEscape(f.Name))
+			if varName != "" {
+				fmt.Fprintf(w, " \\fI%s\\fR", manEscape(varName))
+			}
+			fmt.Fprintf(w, "\n%s\n", manEscape(withNotes(usage, flagNotes(fs, f))))
+			if def := flagDefault(f); def != "" {
+				fmt.Fprintf(w, ".br\nDefault: %s\n", manEscape(def))
+			}
+		}
+	}
+}
+
+func withNotes(usage string, notes []string) string {
+	if len(notes) == 0 {
+		return usage
+	}
+	return usage + " (" + strings.Join(notes, ", ") + ")"
+}
+
+func markdownCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
+
+func manEscape(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+	lines := strings.Split(s, "\n")
+	for idx, line := range lines {
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			lines[idx] = `\&` + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
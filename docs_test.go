@@ -0,0 +1,184 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/tetratelabs/telemetry"
+
+	"github.com/tetratelabs/run"
+)
+
+func TestWriteDocs(t *testing.T) {
+	for _, tt := range []struct {
+		format  run.DocFormat
+		hidden  bool
+		want    []string
+		notWant []string
+	}{
+		{
+			format: run.DocMarkdown,
+			want: []string{
+				"# mytool\n\nmytool does things.\n",
+				"## Commands\n\n| Command | Description |\n| --- | --- |\n| `serve` | start the server |\n",
+				"### Common Service options\n",
+				"| `-n`, `--name` | string | `mytool` | name of this service |\n",
+				"### completer config\n",
+				"| `-m`, `--mode` | string | `fast` | operating mode |\n",
+				"| `--file` | string |  | config file |\n",
+			},
+			notWant: []string{"--completion", "--show-rungroup-units"},
+		},
+		{
+			format: run.DocMarkdown,
+			hidden: true,
+			want: []string{
+				"| `--completion` | string |  | generate a shell completion script for bash, zsh or fish and exit. (hidden) |\n",
+			},
+		},
+		{
+			format: run.DocMan,
+			want: []string{
+				".TH MYTOOL 1 ",
+				".SH NAME\nmytool\n",
+				".SH DESCRIPTION\nmytool does things.\n",
+				".SH COMMANDS\n.TP\n\\fBserve\\fR\nstart the server\n",
+				".SS Common Service options\n",
+				".TP\n\\fB\\-m\\fR, \\fB\\-\\-mode\\fR \\fIstring\\fR\noperating mode\n.br\nDefault: fast\n",
+			},
+			notWant: []string{"completion"},
+		},
+	} {
+		g := run.Group{
+			Name:     "mytool",
+			HelpText: "mytool does things.",
+			Logger:   telemetry.NoopLogger(),
+		}
+		g.Register(&completerConfig{})
+		g.RegisterCommand("serve", "start the server")
+
+		var buf bytes.Buffer
+		if err := g.WriteDocs(&buf, tt.format, tt.hidden); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.format, err)
+		}
+		have := buf.String()
+		for _, want := range tt.want {
+			if !strings.Contains(have, want) {
+				t.Errorf("%s: expected docs to contain %q:\n%s", tt.format, want, have)
+			}
+		}
+		for _, notWant := range tt.notWant {
+			if strings.Contains(have, notWant) {
+				t.Errorf("%s: expected docs to not contain %q:\n%s", tt.format, notWant, have)
+			}
+		}
+	}
+
+	g := run.Group{Name: "mytool", Logger: telemetry.NoopLogger()}
+	defer os.Setenv("SOURCE_DATE_EPOCH", os.Getenv("SOURCE_DATE_EPOCH"))
+	os.Setenv("SOURCE_DATE_EPOCH", "1666051200")
+	var buf bytes.Buffer
+	if err := g.WriteDocs(&buf, run.DocMan, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := `.TH MYTOOL 1 "October 2022" `; !strings.Contains(buf.String(), want) {
+		t.Errorf("expected docs to contain %q:\n%s", want, buf.String())
+	}
+
+	g = run.Group{}
+	if err := g.WriteDocs(&bytes.Buffer{}, "pdf", false); !errors.Is(err, run.ErrUnsupportedDocFormat) {
+		t.Errorf("expected unsupported format error, got %v", err)
+	}
+}
+
+func TestGenerateDocsFlag(t *testing.T) {
+	var (
+		g   = run.Group{Name: "mytool", Logger: telemetry.NoopLogger()}
+		err error
+	)
+	g.Register(&completerConfig{})
+
+	have := captureStdout(t, func() {
+		err = g.RunConfig("--generate-docs", "markdown", "--generate-docs-hidden")
+	})
+	if err != run.ErrBailEarlyRequest {
+		t.Errorf("expected bail early request, got %v", err)
+	}
+	if want := "| `--generate-docs-hidden` |"; !strings.Contains(have, want) {
+		t.Errorf("expected docs to contain %q:\n%s", want, have)
+	}
+}
+
+func TestGenerateThenRun(t *testing.T) {
+	for name, generate := range map[string]func(g *run.Group) error{
+		"docs":   func(g *run.Group) error { return g.WriteDocs(io.Discard, run.DocMarkdown, false) },
+		"schema": func(g *run.Group) error { return g.WriteSchema(io.Discard) },
+	} {
+		var (
+			g = run.Group{Name: "mytool"}
+			c validatedConfig
+		)
+		g.Register(&c)
+		if err := generate(&g); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		c.initialized = 0
+		if err := g.Run("--v", "5", "--log-level", "debug"); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if want, have := 5, c.value; want != have {
+			t.Errorf("%s: want flag value %d, have %d", name, want, have)
+		}
+		if !c.validated {
+			t.Errorf("%s: expected Validate to be called", name)
+		}
+		if want, have := 1, c.initialized; want != have {
+			t.Errorf("%s: want Initialize to be called %d times, have %d", name, want, have)
+		}
+		if c.logger == nil || c.logger.Level() != telemetry.LevelDebug {
+			t.Errorf("%s: expected Unit Logger at debug level", name)
+		}
+	}
+}
+
+type validatedConfig struct {
+	value       int
+	validated   bool
+	initialized int
+	logger      telemetry.Logger
+}
+
+func (v validatedConfig) Name() string { return "validated" }
+
+func (v *validatedConfig) FlagSet() *run.FlagSet {
+	flags := run.NewFlagSet("validated config")
+	flags.IntVar(&v.value, "v", 1, "value")
+	return flags
+}
+
+func (v *validatedConfig) Initialize() { v.initialized++ }
+
+func (v *validatedConfig) SetLogger(l telemetry.Logger) { v.logger = l }
+
+func (v *validatedConfig) Validate() error {
+	v.validated = true
+	return nil
+}
@@ -25,8 +25,8 @@ import (
 	"os"
 	"path"
 	"strings"
+	"time"
 
-	color "github.com/logrusorgru/aurora"
 	"github.com/spf13/pflag"
 	"github.com/tetratelabs/multierror"
 	"github.com/tetratelabs/telemetry"
@@ -52,6 +52,12 @@ func (e Error) Error() string { return string(e) }
 // the job of the application is done.
 const ErrBailEarlyRequest Error = "exit request from flag handler"
 
+// ErrInvalidLogLevel is returned when an unknown --log-level is requested.
+const ErrInvalidLogLevel Error = "invalid log level"
+
+// ErrInvalidLogFormat is returned when an unknown --log-format is requested.
+const ErrInvalidLogFormat Error = "invalid log format"
+
 // ErrRequestedShutdown can be used by Service implementations to gracefully
 // request a shutdown of the application. Group will then exit without errors.
 const ErrRequestedShutdown Error = "shutdown requested"
@@ -60,7 +66,9 @@ const ErrRequestedShutdown Error = "shutdown requested"
 // allowing improved help usage information.
 type FlagSet struct {
 	*pflag.FlagSet
-	Name string
+	Name  string
+	rules []flagRule
+	args  *argSpec
 }
 
 // NewFlagSet returns a new FlagSet for usage in Config objects.
@@ -71,6 +79,69 @@ func NewFlagSet(name string) *FlagSet {
 	}
 }
 
+// namespaced returns a copy of the FlagSet with all flag names prefixed by the
+// provided namespace. The flags in the copy share their values with the
+// original flags. The returned function updates the Changed state of the
+// original flags and should be called after parsing the copy.
+func (f *FlagSet) namespaced(ns string) (*FlagSet, func()) {
+	var (
+		nfs   = NewFlagSet(f.Name)
+		pairs [][2]*pflag.Flag
+	)
+	nfs.SortFlags = f.SortFlags
+	f.VisitAll(func(flag *pflag.Flag) {
+		nf := *flag
+		nf.Name = ns + "." + flag.Name
+		nf.Shorthand = ""
+		nf.ShorthandDeprecated = ""
+		if a, ok := flag.Value.(*aliasValue); ok {
+			nf.Usage = aliasUsage(ns + "." + a.target)
+		}
+		if name := strings.TrimSuffix(flag.Name, "-file"); name != flag.Name {
+			if s := f.Lookup(name); s != nil && isSecret(s) {
+				nf.Usage = secretFileUsage(ns + "." + name)
+			}
+		}
+		nfs.AddFlag(&nf)
+		pairs = append(pairs, [2]*pflag.Flag{flag, &nf})
+	})
+	for _, r := range f.rules {
+		names := make([]string, 0, len(r.names))
+		for _, name := range r.names {
+			names = append(names, ns+"."+name)
+		}
+		r.names = names
+		nfs.rules = append(nfs.rules, r)
+	}
+	nfs.args = f.args
+	return nfs, func() {
+		for _, p := range pairs {
+			p[0].Changed = p[0].Changed || p[1].Changed
+		}
+	}
+}
+
+// commonOptions holds the values of the Common Service options.
+type commonOptions struct {
+	name         string
+	showHelp     bool
+	showHelpAll  bool
+	color        string
+	showVersion  bool
+	showRunGroup bool
+	completion   string
+	docs         string
+	docsHidden   bool
+	schema       bool
+	configFile   string
+	logLevel     string
+	logFormat    string
+	logScopes    []string
+	logSample    log.RateLimit
+	logFile      log.FileConfig
+	logFileSize  int
+}
+
 // Unit is the default interface an object needs to implement for it to be able
 // to register with a Group.
 // Name should return a short but good identifier of the Unit.
@@ -100,6 +171,15 @@ type Namer interface {
 	GroupName(string)
 }
 
+// FlagNamespacer is an extension interface that Config Units can implement if
+// they want to control the namespace used to prefix their flags when Group has
+// FlagNamespaces enabled. If a Config Unit does not implement FlagNamespacer,
+// its Name is used as namespace. Returning an empty string opts the Unit out of
+// namespacing.
+type FlagNamespacer interface {
+	FlagNamespace() string
+}
+
 // Config interface should be implemented by Group Unit objects that manage
 // their own configuration through the use of flags.
 // If a Unit's Validate returns an error it will stop the Group immediately.
@@ -194,17 +274,49 @@ type Group struct {
 	// when --help is requested.
 	HelpText string
 	Logger   telemetry.Logger
+	// EnableConfigFile registers the --config-file Common Service option which
+	// allows flag values to be provided through a config file holding one
+	// "flag-name = value" entry per line. Values provided on the command line
+	// take precedence over the config file.
+	EnableConfigFile bool
+	// ConfigReloadInterval enables watching the config file for changes at the
+	// provided polling interval when running Services. Changed values are
+	// re-applied at runtime to Config Units implementing Reloader.
+	ConfigReloadInterval time.Duration
+	// HelpSections holds optional custom sections to append to the help
+	// output, e.g. examples or the environment variables used.
+	HelpSections []HelpSection
+	// HelpRenderer allows for customizing the help output. If omitted,
+	// DefaultHelpRenderer is used.
+	HelpRenderer HelpRenderer
+	// FlagNamespaces enables automatic prefixing of the flags registered by
+	// Config Units with their namespace, e.g. --cache.redis-addr and
+	// --session.redis-addr. This allows the same reusable Unit type to be
+	// registered multiple times without its flags colliding. Shorthand flags
+	// are dropped from namespaced flags. See FlagNamespacer.
+	FlagNamespaces bool
 
-	f *FlagSet
-	i []Initializer
-	n []Namer
-	c []Config
-	p []PreRunner
-	s []Service
-	x []ServiceContext
+	f    *FlagSet
+	gFS  *FlagSet
+	fs   []*FlagSet
+	opts commonOptions
+	cmds []command
+	cmd  *command
+	args []string
+	i    []Initializer
+	l    []LoggerSetter
+	o    []StatusObserver
+	d    []Drainer
+	n    []Namer
+	c    []Config
+	p    []PreRunner
+	s    []Service
+	x    []ServiceContext
 
+	watcher      *configWatcher
 	configured   bool
 	hsRegistered bool
+	logFile      *log.File
 }
 
 // Register will inspect the provided objects implementing the Unit interface to
@@ -229,6 +341,18 @@ func (g *Group) Register(units ...Unit) []bool {
 			g.i = append(g.i, i)
 			hasRegistered[idx] = true
 		}
+		if l, ok := units[idx].(LoggerSetter); ok {
+			g.l = append(g.l, l)
+			hasRegistered[idx] = true
+		}
+		if o, ok := units[idx].(StatusObserver); ok {
+			g.o = append(g.o, o)
+			hasRegistered[idx] = true
+		}
+		if d, ok := units[idx].(Drainer); ok {
+			g.d = append(g.d, d)
+			hasRegistered[idx] = true
+		}
 		if !g.configured {
 			// if RunConfig has been called we can no longer register Config
 			// phases of Units
@@ -281,6 +405,24 @@ func (g *Group) Deregister(units ...Unit) []bool {
 				hasDeregistered[idx] = true
 			}
 		}
+		for i := range g.l {
+			if g.l[i] != nil && g.l[i].(Unit) == units[idx] {
+				g.l[i] = nil // can't resize slice during Run, so nil
+				hasDeregistered[idx] = true
+			}
+		}
+		for i := range g.o {
+			if g.o[i] != nil && g.o[i].(Unit) == units[idx] {
+				g.o[i] = nil // can't resize slice during Run, so nil
+				hasDeregistered[idx] = true
+			}
+		}
+		for i := range g.d {
+			if g.d[i] != nil && g.d[i].(Unit) == units[idx] {
+				g.d[i] = nil // can't resize slice during Run, so nil
+				hasDeregistered[idx] = true
+			}
+		}
 		for i := range g.n {
 			if g.n[i] != nil && g.n[i].(Unit) == units[idx] {
 				g.n[i] = nil // can't resize slice during Run, so nil
@@ -315,20 +457,17 @@ func (g *Group) Deregister(units ...Unit) []bool {
 	return hasDeregistered
 }
 
-// RunConfig runs the Config phase of all registered Config aware Units.
-// Only use this function if needing to add additional wiring between config
-// and (pre)run phases and a separate PreRunner phase is not an option.
-// In most cases it is best to use the Run method directly as it will run the
-// Config phase prior to executing the PreRunner and Service phases.
-// If an error is returned the application must shut down as it is considered
-// fatal. In case the error is an ErrBailEarlyRequest the application
-// should clean up and exit without an error code as an ErrBailEarlyRequest
-// is not an actual error but a request for Help, Version or other task that has
-// been finished and there is no more work left to handle.
-func (g *Group) RunConfig(args ...string) (err error) {
-	g.configured = true
+// registerFlags sets up the Group defaults, the Common Service options and the
+// FlagSets of all registered Config Units as found after running the
+// Initializer and Namer phases. It returns the provided args without the
+// subcommand selection and the functions to call after flag parsing.
+func (g *Group) registerFlags(args []string) (_ []string, syncs []func()) {
+	provider := g.loggerProvider()
+	if provider != nil {
+		g.Logger = provider.Logger()
+	}
 	if g.Logger == nil {
-		g.Logger = &log.Logger{}
+		g.Logger = log.New()
 	}
 
 	if g.Name == "" {
@@ -338,54 +477,102 @@ func (g *Group) RunConfig(args ...string) (err error) {
 
 	g.HelpText = strings.ReplaceAll(g.HelpText, BinaryName, os.Args[0])
 
-	defer func() {
-		if err != nil && err != ErrBailEarlyRequest {
-			g.Logger.Error("unexpected exit", err)
-			err = multierror.SetFormatter(err, multierror.ListFormatFunc)
-		}
-	}()
-
-	// run configuration stage
 	g.f = NewFlagSet(g.Name)
 	g.f.SortFlags = false // keep order of flag registration
 	g.f.Usage = func() {
-		fmt.Printf("Usage of %s:\n", g.Name)
-		if g.HelpText != "" {
-			fmt.Printf("%s\n", g.HelpText)
+		fmt.Printf("Usage of %s:\n", g.usageName())
+		if helpText := g.helpText(); helpText != "" {
+			fmt.Printf("%s\n", helpText)
 		}
 		fmt.Printf("Flags:\n")
 		g.f.PrintDefaults()
 	}
 
 	// register default rungroup flags
-	var (
-		name         string
-		showHelp     bool
-		showVersion  bool
-		showRunGroup bool
-	)
-
 	gFS := NewFlagSet("Common Service options")
 	gFS.SortFlags = false
-	gFS.StringVarP(&name, "name", "n", g.Name, `name of this service`)
-	gFS.BoolVarP(&showVersion, "version", "v", false,
+	gFS.StringVarP(&g.opts.name, "name", "n", g.Name, `name of this service`)
+	gFS.BoolVarP(&g.opts.showVersion, "version", "v", false,
 		"show version information and exit.")
-	gFS.BoolVarP(&showHelp, "help", "h", false,
+	gFS.BoolVarP(&g.opts.showHelp, "help", "h", false,
 		"show this help information and exit.")
-	gFS.BoolVar(&showRunGroup, "show-rungroup-units", false, "show run group units")
+	gFS.BoolVar(&g.opts.showHelpAll, "help-all", false,
+		"show this help information including hidden flags and exit.")
+	gFS.StringVar(&g.opts.color, "color", "auto",
+		"colorize help output: auto, always or never.")
+	if provider == nil {
+		// a LoggerProvider registers its own log flags
+		gFS.StringVar(&g.opts.logLevel, "log-level", g.Logger.Level().String(),
+			"log level: none, error, info or debug.")
+		if l, ok := g.Logger.(*log.Logger); ok {
+			gFS.StringVar(&g.opts.logFormat, "log-format", string(l.Format()),
+				"log format: text, logfmt or json.")
+			gFS.DurationVar(&g.opts.logSample.Interval, "log-sample-interval", 0,
+				"rate limit identical log lines per interval, 0 disables rate limiting.")
+			gFS.IntVar(&g.opts.logSample.First, "log-sample-first", 100,
+				"number of identical log lines logged per interval before sampling.")
+			gFS.IntVar(&g.opts.logSample.Thereafter, "log-sample-thereafter", 100,
+				"log 1 in N identical log lines after the first ones, 0 drops them.")
+			gFS.BoolVar(&g.opts.logSample.ExemptErrors, "log-sample-exempt-errors", false,
+				"do not rate limit error log lines.")
+			gFS.StringVar(&g.opts.logFile.Path, "log-file", "",
+				"write log lines to this file instead of stderr, reopened on SIGHUP.")
+			gFS.IntVar(&g.opts.logFileSize, "log-file-max-size", 100,
+				"rotate the log file after it reaches this size in megabytes, 0 disables.")
+			gFS.DurationVar(&g.opts.logFile.MaxAge, "log-file-max-age", 0,
+				"rotate the log file after it has been open this long, 0 disables.")
+			gFS.IntVar(&g.opts.logFile.MaxBackups, "log-file-max-backups", 0,
+				"number of rotated log files to keep, 0 keeps all.")
+			gFS.BoolVar(&g.opts.logFile.Compress, "log-file-compress", false,
+				"gzip rotated log files.")
+		}
+		if _, ok := g.Logger.(scopedLogger); ok {
+			gFS.StringSliceVar(&g.opts.logScopes, "log-scope-level", nil,
+				"log level per scope (Unit name), e.g. xds:debug,db:warn.")
+		}
+	}
+	gFS.BoolVar(&g.opts.showRunGroup, "show-rungroup-units", false, "show run group units")
 	_ = gFS.MarkHidden("show-rungroup-units")
+	gFS.StringVar(&g.opts.completion, "completion", "",
+		"generate a shell completion script for bash, zsh or fish and exit.")
+	_ = gFS.MarkHidden("completion")
+	gFS.StringVar(&g.opts.docs, "generate-docs", "",
+		"generate reference documentation in markdown or man format and exit.")
+	_ = gFS.MarkHidden("generate-docs")
+	gFS.BoolVar(&g.opts.docsHidden, "generate-docs-hidden", false,
+		"include hidden flags in the generated reference documentation.")
+	_ = gFS.MarkHidden("generate-docs-hidden")
+	gFS.BoolVar(&g.opts.schema, "generate-schema", false,
+		"generate a JSON Schema of the accepted configuration and exit.")
+	_ = gFS.MarkHidden("generate-schema")
+	if g.EnableConfigFile {
+		gFS.StringVar(&g.opts.configFile, "config-file", "",
+			"path to a config file holding \"flag-name = value\" entries.")
+	}
 	g.f.AddFlagSet(gFS.FlagSet)
+	g.gFS = gFS
 
-	// default to os.Args if args parameter was omitted
-	if len(args) == 0 {
-		args = os.Args[1:]
+	// dispatch to the requested subcommand and register its Units
+	var cmdIdx int
+	if cmdIdx, args = g.selectCommand(gFS, args); cmdIdx != -1 {
+		g.cmd = &g.cmds[cmdIdx]
+		g.cmd.helpText = strings.ReplaceAll(g.cmd.helpText, BinaryName, os.Args[0])
+		g.Register(g.cmd.units...)
 	}
+	// from here on we can no longer register Config phases of Units
+	g.configured = true
 
 	// parse our run group flags only (not the plugin ones)
+	gFS.ParseErrorsWhitelist.UnknownFlags = true
 	_ = gFS.Parse(args)
-	if name != "" {
-		g.Name = name
+	if g.opts.name != "" {
+		g.Name = g.opts.name
 	}
+	// apply the requested log settings as early as possible, invalid values
+	// are reported after parsing all flags
+	_ = g.configureLogger()
+	// provide Units with their scoped Logger
+	g.setLoggers()
 
 	// initialize all Units implementing Initializer
 	for idx, i := range g.i {
@@ -426,6 +613,11 @@ func (g *Group) RunConfig(args ...string) (err error) {
 			g.Logger.Debug("config object did not return a flagset", "index", idx)
 			continue
 		}
+		if ns := g.flagNamespace(g.c[idx]); ns != "" {
+			var sync func()
+			fs[idx], sync = fs[idx].namespaced(ns)
+			syncs = append(syncs, sync)
+		}
 		fs[idx].VisitAll(func(f *pflag.Flag) {
 			if g.f.Lookup(f.Name) != nil {
 				g.Logger.Debug("ignoring duplicate flag", "name", f.Name, "index", idx)
@@ -434,33 +626,98 @@ func (g *Group) RunConfig(args ...string) (err error) {
 			g.f.AddFlag(f)
 		})
 	}
+	g.fs = fs
+
+	return args, syncs
+}
+
+// RunConfig runs the Config phase of all registered Config aware Units.
+// Only use this function if needing to add additional wiring between config
+// and (pre)run phases and a separate PreRunner phase is not an option.
+// In most cases it is best to use the Run method directly as it will run the
+// Config phase prior to executing the PreRunner and Service phases.
+// If an error is returned the application must shut down as it is considered
+// fatal. In case the error is an ErrBailEarlyRequest the application
+// should clean up and exit without an error code as an ErrBailEarlyRequest
+// is not an actual error but a request for Help, Version or other task that has
+// been finished and there is no more work left to handle.
+func (g *Group) RunConfig(args ...string) (err error) {
+	defer func() {
+		if err != nil && err != ErrBailEarlyRequest {
+			g.Logger.Error("unexpected exit", g.redact(err))
+			err = g.redact(multierror.SetFormatter(err, multierror.ListFormatFunc))
+		}
+	}()
+
+	// default to os.Args if args parameter was omitted
+	if len(args) == 0 {
+		args = os.Args[1:]
+	}
+
+	// run configuration stage
+	args, syncs := g.registerFlags(args)
 
 	// parse FlagSet and exit on error
 	if err = g.f.Parse(args); err != nil {
 		return err
 	}
+	g.args = g.f.Args()
+	// apply the values found in the config file, if provided
+	if g.opts.configFile != "" {
+		if err = g.loadConfigFile(); err != nil {
+			return err
+		}
+	}
+	// map the values of deprecated aliases onto their replacement flags
+	if err = g.resolveAliases(); err != nil {
+		return err
+	}
+	// fill the secret flags not provided yet from their file or environment
+	if err = g.resolveSecrets(); err != nil {
+		return err
+	}
+	if err = g.configureLogger(); err != nil {
+		return err
+	}
+	// make sure namespaced flags update the Changed state of the flags as
+	// registered by the Config Units
+	for idx := range syncs {
+		syncs[idx]()
+	}
 
 	// bail early on help or version requests
 	switch {
-	case showHelp:
-		fmt.Println(color.Cyan(color.Bold(fmt.Sprintf("Usage of %s:", g.Name))))
-		if g.HelpText != "" {
-			fmt.Printf("%s\n", g.HelpText)
-		}
-		fmt.Printf("%s\n\n", color.Cyan(color.Bold("Flags:")))
-		fmt.Printf("%s\n%s\n", color.Cyan("* "+gFS.Name), gFS.FlagUsages())
-		for _, f := range fs {
-			if f != nil {
-				fmt.Printf("%s\n%s\n", color.Cyan("* "+f.Name), f.FlagUsages())
-			}
+	case g.opts.showHelp, g.opts.showHelpAll:
+		if err = g.renderHelp(os.Stdout); err != nil {
+			return err
 		}
 		return ErrBailEarlyRequest
-	case showVersion:
+	case g.opts.showVersion:
 		version.Show(g.Name)
 		return ErrBailEarlyRequest
-	case showRunGroup:
+	case g.opts.showRunGroup:
 		fmt.Println(g.ListUnits())
 		return ErrBailEarlyRequest
+	case g.opts.completion != "":
+		if err = g.writeCompletion(os.Stdout, g.opts.completion); err != nil {
+			return err
+		}
+		return ErrBailEarlyRequest
+	case g.opts.docs != "":
+		if err = g.WriteDocs(os.Stdout, DocFormat(g.opts.docs), g.opts.docsHidden); err != nil {
+			return err
+		}
+		return ErrBailEarlyRequest
+	case g.opts.schema:
+		if err = g.WriteSchema(os.Stdout); err != nil {
+			return err
+		}
+		return ErrBailEarlyRequest
+	}
+
+	// positional arguments not accepted by any Unit must select a subcommand
+	if err = g.checkCommand(); err != nil {
+		return err
 	}
 
 	// Validate Config inputs
@@ -480,6 +737,20 @@ func (g *Group) RunConfig(args ...string) (err error) {
 				"item", fmt.Sprintf("(%d/%d)", itemNr, len(g.c)))
 			l.Debug("validate")
 			defer l.Debug("validate-exit", debugLogError(vErr)...)
+			// evaluate the declarative flag rules first, the Unit's own
+			// validation logic can then rely on them being satisfied
+			rErrs := g.fs[itemNr-1].checkRules()
+			if aErr := g.fs[itemNr-1].checkArgs(g.args); aErr != nil {
+				rErrs = append(rErrs, aErr)
+			}
+			if len(rErrs) > 0 {
+				vErr = multierror.Append(nil, rErrs...)
+				err = multierror.Append(err, rErrs...)
+				return
+			}
+			if r, ok := cfg.(ArgsReceiver); ok {
+				r.ReceiveArgs(g.args)
+			}
 			vErr = cfg.Validate()
 			if vErr != nil {
 				err = multierror.Append(err, vErr)
@@ -505,30 +776,30 @@ func (g *Group) RunConfig(args ...string) (err error) {
 //
 // The following phases are executed in the following sequence:
 //
-//   Initialization phase (serially, in order of Unit registration)
-//     - Initialize()     Initialize Unit's supporting this interface.
+//	Initialization phase (serially, in order of Unit registration)
+//	  - Initialize()     Initialize Unit's supporting this interface.
 //
-//   Config phase (serially, in order of Unit registration)
-//     - FlagSet()        Get & register all FlagSets from Config Units.
-//     - Flag Parsing     Using the provided args (os.Args if empty).
-//     - Validate()       Validate Config Units. Exit on first error.
+//	Config phase (serially, in order of Unit registration)
+//	  - FlagSet()        Get & register all FlagSets from Config Units.
+//	  - Flag Parsing     Using the provided args (os.Args if empty).
+//	  - Validate()       Validate Config Units. Exit on first error.
 //
-//   PreRunner phase (serially, in order of Unit registration)
-//     - PreRun()         Execute PreRunner Units. Exit on first error.
+//	PreRunner phase (serially, in order of Unit registration)
+//	  - PreRun()         Execute PreRunner Units. Exit on first error.
 //
-//   Service and ServiceContext phase (concurrently)
-//     - Serve()          Execute all Service Units in separate Go routines.
-//       ServeContext()   Execute all ServiceContext Units.
-//     - Wait             Block until one of the Serve() or ServeContext()
-//                        methods returns.
-//     - GracefulStop()   Call interrupt handlers of all Service Units and
-//                        cancel the context.Context provided to all the
-//                        ServiceContext units registered.
+//	Service and ServiceContext phase (concurrently)
+//	  - Serve()          Execute all Service Units in separate Go routines.
+//	    ServeContext()   Execute all ServiceContext Units.
+//	  - Wait             Block until one of the Serve() or ServeContext()
+//	                     methods returns.
+//	  - GracefulStop()   Call interrupt handlers of all Service Units and
+//	                     cancel the context.Context provided to all the
+//	                     ServiceContext units registered.
 //
-//   Run will return with the originating error on:
-//   - first Config.Validate()  returning an error
-//   - first PreRunner.PreRun() returning an error
-//   - first Service.Serve() or ServiceContext.ServeContext() returning
+//	Run will return with the originating error on:
+//	- first Config.Validate()  returning an error
+//	- first PreRunner.PreRun() returning an error
+//	- first Service.Serve() or ServiceContext.ServeContext() returning
 //
 // Note: it is perfectly acceptable to use Group without Service and
 // ServiceContext units. In this case Run will just return immediately after
@@ -536,6 +807,9 @@ func (g *Group) RunConfig(args ...string) (err error) {
 // is particularly convenient if using the common pkg middlewares in a CLI,
 // script, or other ephemeral environment.
 func (g *Group) Run(args ...string) (err error) {
+	// flush and close the log output after our final log lines
+	defer g.closeLogOutput()
+
 	if !g.configured {
 		// run config registration and flag parsing stages
 		if err = g.RunConfig(args...); err != nil {
@@ -565,15 +839,36 @@ func (g *Group) Run(args ...string) (err error) {
 		}
 		// test if this is a requested / expected shutdown...
 		if errors.Is(err, ErrRequestedShutdown) {
-			g.Logger.Info("received shutdown request", "details", err)
+			g.Logger.Info("received shutdown request", "details", g.redact(err))
 			err = nil
 			return
 		}
 		// actual fatal error
-		g.Logger.Error("unexpected exit", err)
-		err = multierror.SetFormatter(err, multierror.ListFormatFunc)
+		g.Logger.Error("unexpected exit", g.redact(err))
+		err = g.redact(multierror.SetFormatter(err, multierror.ListFormatFunc))
 	}()
 
+	// provide Units registered after the Config phase with their Logger
+	g.setLoggers()
+
+	// provide the StatusObserver Units with the lifecycle state of our Units
+	// and the means to notify our Drainer Units
+	var drainers []Drainer
+	for _, d := range g.d {
+		// a Drainer might have been de-registered
+		if d != nil {
+			drainers = append(drainers, d)
+		}
+	}
+	status := newStatus(drainers)
+	defer status.close()
+	for _, o := range g.o {
+		// a StatusObserver might have been de-registered
+		if o != nil {
+			o.ObserveStatus(status)
+		}
+	}
+
 	// call our Initializer (again)
 	// In case a Unit was registered for PreRun and/or Serve phase after Config
 	// phase was completed, we still want to run the Initializer if existent.
@@ -631,12 +926,29 @@ func (g *Group) Run(args ...string) (err error) {
 		// we have no Service or ServiceContext to run.
 		return nil
 	}
+	if g.watcher != nil {
+		// watch the config file for changes while running our services
+		x = append(x, g.watcher)
+	}
+	if g.logFile != nil && logReopenSignal != nil {
+		// reopen the log file on SIGHUP while running our services
+		x = append(x, &logFileReopener{g: g})
+	}
 
 	// setup our cancellable context and error channel
 	ctx, cancel := context.WithCancel(context.Background())
 	errs := make(chan error, len(s)+len(x))
 	hasServices = true
 
+	names := make([]string, 0, len(s)+len(x))
+	for _, svc := range s {
+		names = append(names, svc.Name())
+	}
+	for _, svc := range x {
+		names = append(names, svc.Name())
+	}
+	status.serve(names)
+
 	// run each Service
 	for idx, svc := range s {
 		go func(itemNr int, svc Service) {
@@ -647,6 +959,7 @@ func (g *Group) Run(args ...string) (err error) {
 			l.Debug("serve")
 			defer l.Debug("serve-exit", debugLogError(err)...)
 			err = svc.Serve()
+			status.stopped(itemNr - 1)
 			errs <- err
 		}(idx+1, svc)
 	}
@@ -659,7 +972,9 @@ func (g *Group) Run(args ...string) (err error) {
 				"item", fmt.Sprintf("(%d/%d)", itemNr, len(x)))
 			l.Debug("serve-context")
 			defer l.Debug("serve-context-exit", debugLogError(err)...)
-			err = svc.ServeContext(ctx)
+			// allow the Unit's log lines to carry its name automatically
+			err = svc.ServeContext(telemetry.KeyValuesToContext(ctx, "unit", svc.Name()))
+			status.stopped(len(s) + itemNr - 1)
 			errs <- err
 		}(idx+1, svc)
 	}
@@ -669,6 +984,7 @@ func (g *Group) Run(args ...string) (err error) {
 	err = <-errs
 
 	// signal all Service and ServiceContext Units to stop
+	status.stopping()
 	cancel()
 	for idx, svc := range s {
 		go func(itemNr int, svc Service) {
@@ -698,6 +1014,9 @@ func (g Group) ListUnits() string {
 		t = "cli"
 	)
 
+	if g.cmd != nil {
+		s += "\n - command: " + g.cmd.name
+	}
 	if len(g.i) > 0 {
 		s += "\n - initialize: "
 		for _, u := range g.i {
@@ -744,6 +1063,52 @@ func (g Group) ListUnits() string {
 	return fmt.Sprintf("Group: %s [%s]%s", g.Name, t, s)
 }
 
+// configureLogger sets the log level, format, scope levels, rate limiting and
+// file output of the Group Logger if requested through the --log-level,
+// --log-format, --log-scope-level, --log-sample-* and --log-file* flags.
+func (g *Group) configureLogger() error {
+	if f := g.gFS.Lookup("log-level"); f != nil && f.Changed {
+		lvl, err := log.ParseLevel(g.opts.logLevel)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidLogLevel, err)
+		}
+		g.Logger.SetLevel(lvl)
+	}
+	if f := g.gFS.Lookup("log-format"); f != nil && f.Changed {
+		format, ok := log.FromFormat(strings.ToLower(g.opts.logFormat))
+		if !ok {
+			return fmt.Errorf("%w: %q (supported: text, logfmt, json)",
+				ErrInvalidLogFormat, g.opts.logFormat)
+		}
+		g.Logger.(*log.Logger).SetFormat(format)
+	}
+	if f := g.gFS.Lookup("log-sample-interval"); f != nil && f.Changed {
+		g.Logger.(*log.Logger).SetRateLimit(g.opts.logSample)
+	}
+	if g.opts.logFile.Path != "" {
+		if err := g.openLogFile(); err != nil {
+			return err
+		}
+	}
+	if f := g.gFS.Lookup("log-scope-level"); f != nil && f.Changed {
+		return g.applyScopeLevels(g.Logger.(scopedLogger), g.opts.logScopes)
+	}
+	return nil
+}
+
+// flagNamespace returns the namespace to prefix the flags of the provided
+// Config Unit with. It returns an empty string if namespacing is not enabled
+// or the Unit opted out.
+func (g *Group) flagNamespace(c Config) string {
+	if !g.FlagNamespaces {
+		return ""
+	}
+	if n, ok := c.(FlagNamespacer); ok {
+		return n.FlagNamespace()
+	}
+	return c.Name()
+}
+
 func debugLogError(err error) (kv []interface{}) {
 	if err == nil {
 		return
@@ -15,16 +15,21 @@
 package run_test
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/tetratelabs/multierror"
+	"github.com/tetratelabs/telemetry"
 
 	"github.com/tetratelabs/run"
+	"github.com/tetratelabs/run/pkg/log"
 	"github.com/tetratelabs/run/pkg/test"
 )
 
@@ -218,6 +223,193 @@ func TestDuplicateFlag(t *testing.T) {
 	}
 }
 
+func TestFlagNamespaces(t *testing.T) {
+	var (
+		g       = run.Group{FlagNamespaces: true}
+		cache   = namespacedConfig{ns: "cache"}
+		session = namespacedConfig{ns: "session"}
+		plain   flagTestConfig
+	)
+
+	g.Register(&cache, &session, &plain)
+
+	if err := g.Run("./myService",
+		"--cache.flagtest", "3", "--session.flagtest=4", "--flagtest10.flagtest=5",
+	); err != nil {
+		t.Fatalf("Expected proper close, got %v", err)
+	}
+	if want, have := 3, cache.value; want != have {
+		t.Errorf("Expected cache flag = %d, got %d", want, have)
+	}
+	if !cache.changed {
+		t.Errorf("Expected cache flag to be marked as changed")
+	}
+	if want, have := 4, session.value; want != have {
+		t.Errorf("Expected session flag = %d, got %d", want, have)
+	}
+	if want, have := 5, plain.value; want != have {
+		t.Errorf("Expected unit name namespaced flag = %d, got %d", want, have)
+	}
+
+	g = run.Group{FlagNamespaces: true}
+	g.Register(&namespacedConfig{ns: "cache"})
+	if err := g.Run("./myService", "-f", "3"); err == nil {
+		t.Errorf("Expected shorthand flag to be dropped from namespaced flags")
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	g := run.Group{}
+	if err := g.RunConfig("--log-level", "debug"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want, have := telemetry.LevelDebug, g.Logger.Level(); want != have {
+		t.Errorf("want level %v, have %v", want, have)
+	}
+
+	g = run.Group{}
+	if err := g.RunConfig("--log-level", "verbose"); !errors.Is(err, run.ErrInvalidLogLevel) {
+		t.Errorf("expected invalid log level error, got %v", err)
+	}
+
+	// custom loggers keep their level unless requested otherwise
+	g = run.Group{Logger: log.New()}
+	g.Logger.SetLevel(telemetry.LevelError)
+	if err := g.RunConfig("--name", "test"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want, have := telemetry.LevelError, g.Logger.Level(); want != have {
+		t.Errorf("want level %v, have %v", want, have)
+	}
+}
+
+func TestLogFormat(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		l   = log.New()
+		g   = run.Group{Name: "test", Logger: l}
+	)
+	l.SetOutput(&buf)
+	if err := g.RunConfig("--log-format", "json"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := `"level":"info","msg":"test v0.0.0-unofficial started"}`; !strings.Contains(buf.String(), want) {
+		t.Errorf("expected %q in %q", want, buf.String())
+	}
+
+	g = run.Group{Logger: log.New()}
+	if err := g.RunConfig("--log-format", "xml"); !errors.Is(err, run.ErrInvalidLogFormat) {
+		t.Errorf("expected invalid log format error, got %v", err)
+	}
+
+	// --log-format is only available for the built-in Logger
+	g = run.Group{Logger: telemetry.NoopLogger()}
+	if err := g.RunConfig("--log-format", "json"); err == nil {
+		t.Errorf("expected unknown flag error")
+	}
+}
+
+func TestLogSampling(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		l   = log.New()
+		g   = run.Group{Logger: l}
+	)
+	l.SetOutput(&buf)
+	l.SetFormat(log.FormatLogfmt)
+	if err := g.RunConfig("--log-sample-interval", "1h",
+		"--log-sample-first", "1", "--log-sample-thereafter", "0"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	buf.Reset()
+	for i := 0; i < 5; i++ {
+		l.Info("retrying")
+	}
+	if want, have := 1, strings.Count(buf.String(), "msg=retrying"); want != have {
+		t.Errorf("want %d lines, have %d", want, have)
+	}
+	l.SetRateLimit(log.RateLimit{})
+}
+
+func TestLogFile(t *testing.T) {
+	var (
+		path = filepath.Join(t.TempDir(), "test.log")
+		l    = log.New()
+		g    = run.Group{Logger: l}
+	)
+	g.Register(&loggingServiceContext{logger: l})
+
+	if err := g.Run("./myService", "--log-format", "logfmt", "--log-file", path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"msg=serving", `msg="received shutdown request"`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("expected %q in %q", want, b)
+		}
+	}
+}
+
+func TestServeContextLogging(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		l   = log.New()
+		g   = run.Group{Logger: l}
+	)
+	l.SetOutput(&buf)
+	l.SetFormat(log.FormatLogfmt)
+	g.Register(&loggingServiceContext{logger: l})
+
+	if err := g.Run("./myService"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "msg=serving unit=ctx-logger\n"; !strings.Contains(buf.String(), want) {
+		t.Errorf("expected %q in %q", want, buf.String())
+	}
+}
+
+func TestLoggerScopes(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		l   = log.New()
+		g   = run.Group{Logger: l}
+		xds = scopedUnit{name: "xds"}
+		db  = scopedUnit{name: "db"}
+	)
+	l.SetOutput(&buf)
+	l.SetFormat(log.FormatLogfmt)
+	g.Register(&xds, &db)
+
+	if err := g.RunConfig("--log-scope-level", "xds:debug,db:warn"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	buf.Reset()
+	xds.logger.Debug("xds debug")
+	db.logger.Debug("db debug")
+	if want := " msg=\"xds debug\" scope=xds\n"; !strings.HasSuffix(buf.String(), want) || strings.Count(buf.String(), "\n") != 1 {
+		t.Errorf("want %q, have %q", want, buf.String())
+	}
+
+	g = run.Group{Logger: log.New()}
+	if err := g.RunConfig("--log-scope-level", "xds=debug"); !errors.Is(err, run.ErrInvalidLogLevel) {
+		t.Errorf("expected invalid log level error, got %v", err)
+	}
+
+	// Loggers without scope support provide the Group Logger with scope name
+	u := scopedUnit{name: "plain"}
+	g = run.Group{Logger: telemetry.NoopLogger()}
+	g.Register(&u)
+	if err := g.RunConfig("--name", "test"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if u.logger == nil {
+		t.Errorf("expected Logger to be set")
+	}
+}
+
 func TestRuntimeDeregister(t *testing.T) {
 	for _, svcs := range [][]string{
 		{"--s1-disable"},
@@ -356,6 +548,27 @@ func (f *flagTestConfig) FlagSet() *run.FlagSet {
 
 func (f flagTestConfig) Validate() error { return nil }
 
+type namespacedConfig struct {
+	ns      string
+	value   int
+	changed bool
+	flags   *run.FlagSet
+}
+
+func (n namespacedConfig) Name() string          { return "namespaced-" + n.ns }
+func (n namespacedConfig) FlagNamespace() string { return n.ns }
+
+func (n *namespacedConfig) FlagSet() *run.FlagSet {
+	n.flags = run.NewFlagSet("namespaced config")
+	n.flags.IntVarP(&n.value, "flagtest", "f", 10, "flagtester")
+	return n.flags
+}
+
+func (n *namespacedConfig) Validate() error {
+	n.changed = n.flags.Changed("flagtest")
+	return nil
+}
+
 type failingConfig struct {
 	e error
 }
@@ -507,3 +720,120 @@ func (s *serviceContext) ServeContext(ctx context.Context) error {
 	s.contextDone = true
 	return nil
 }
+
+type loggingServiceContext struct {
+	logger telemetry.Logger
+}
+
+func (s loggingServiceContext) Name() string { return "ctx-logger" }
+
+func (s loggingServiceContext) ServeContext(ctx context.Context) error {
+	s.logger.Context(ctx).Info("serving")
+	return run.ErrRequestedShutdown
+}
+
+type scopedUnit struct {
+	name   string
+	logger telemetry.Logger
+}
+
+func (s scopedUnit) Name() string { return s.name }
+
+func (s *scopedUnit) SetLogger(l telemetry.Logger) { s.logger = l }
+
+type statusObserver struct {
+	status *run.Status
+}
+
+func (s *statusObserver) Name() string                 { return "status-observer" }
+func (s *statusObserver) ObserveStatus(st *run.Status) { s.status = st }
+
+func TestStatusObserver(t *testing.T) {
+	var (
+		g        = run.Group{Logger: telemetry.NoopLogger()}
+		observer = &statusObserver{}
+		serving  []run.UnitStatus
+		stopping []string
+	)
+	g.Register(observer, &test.TestSvc{
+		SvcName: "first",
+		Execute: func() error {
+			serving = observer.status.Units()
+			return errClose
+		},
+	}, &test.TestSvc{
+		SvcName: "second",
+		Execute: func() error {
+			<-time.After(10 * time.Millisecond)
+			stopping = observer.status.Stopping()
+			return nil
+		},
+	})
+
+	if err := g.Run(); !errors.Is(err, errClose) {
+		t.Fatalf("expected %v, got %v", errClose, err)
+	}
+	if want, have := 2, len(serving); want != have {
+		t.Fatalf("want %d units, have %d", want, have)
+	}
+	for _, u := range serving {
+		if u.State != run.StateServing && u.Name != "second" {
+			t.Errorf("expected %s to be serving, got %s", u.Name, u.State)
+		}
+	}
+	if want, have := "second", strings.Join(stopping, ","); want != have {
+		t.Errorf("want stopping units %q, have %q", want, have)
+	}
+	for _, u := range observer.status.Units() {
+		if u.State != run.StateStopped {
+			t.Errorf("expected %s to be stopped, got %s", u.Name, u.State)
+		}
+	}
+	select {
+	case <-observer.status.Done():
+	default:
+		t.Errorf("expected status to be done")
+	}
+}
+
+type drainer struct {
+	name    string
+	drained int
+}
+
+func (d *drainer) Name() string { return d.name }
+func (d *drainer) Drain()       { d.drained++ }
+
+func TestDrainer(t *testing.T) {
+	var (
+		g        = run.Group{Logger: telemetry.NoopLogger()}
+		observer = &statusObserver{}
+		first    = &drainer{name: "first"}
+		second   = &drainer{name: "second"}
+	)
+	g.Register(observer, first, second, &test.TestSvc{
+		SvcName: "svc",
+		Execute: func() error {
+			if observer.status.Draining() {
+				t.Error("expected status not to be draining")
+			}
+			observer.status.Drain()
+			observer.status.Drain()
+			if !observer.status.Draining() {
+				t.Error("expected status to be draining")
+			}
+			return errClose
+		},
+	})
+	g.Deregister(second)
+
+	if err := g.Run(); !errors.Is(err, errClose) {
+		t.Fatalf("expected %v, got %v", errClose, err)
+	}
+	if want, have := 1, first.drained; want != have {
+		t.Errorf("first: want %d drains, have %d", want, have)
+	}
+	if want, have := 0, second.drained; want != have {
+		t.Errorf("second: want %d drains, have %d", want, have)
+	}
+}
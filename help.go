@@ -0,0 +1,259 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	color "github.com/logrusorgru/aurora"
+	"github.com/spf13/pflag"
+)
+
+// HelpSection holds a custom section to add to the help output, e.g. examples
+// or the environment variables used by the application.
+type HelpSection struct {
+	Title string
+	Body  string
+}
+
+// HelpCommand holds the details of a registered subcommand for help output.
+type HelpCommand struct {
+	Name     string
+	HelpText string
+}
+
+// Help holds everything a HelpRenderer needs to render the help output of a
+// Group.
+type Help struct {
+	// Name holds the Group name, followed by the selected subcommand if
+	// applicable.
+	Name string
+	// Args holds the usage of the positional arguments declared by the
+	// Config Units, if any.
+	Args string
+	// HelpText holds the Group's HelpText or the selected subcommand's help.
+	HelpText string
+	// Commands holds the registered subcommands if none was selected.
+	Commands []HelpCommand
+	// FlagSets holds the Common Service options, followed by the FlagSets of
+	// all Config Units.
+	FlagSets []*FlagSet
+	// Sections holds the Group's custom HelpSections.
+	Sections []HelpSection
+	// ShowHidden is set if hidden flags should be rendered (--help-all).
+	ShowHidden bool
+	// Color is set if the output supports ANSI colors.
+	Color bool
+	// Width holds the terminal width to wrap the output at. If zero, the
+	// output should not be wrapped.
+	Width int
+}
+
+// HelpRenderer renders the help output of a Group when --help or --help-all
+// is requested. Set Group.HelpRenderer to customize the help output.
+type HelpRenderer interface {
+	RenderHelp(w io.Writer, h Help) error
+}
+
+// HelpRendererFunc allows a function to be used as HelpRenderer.
+type HelpRendererFunc func(w io.Writer, h Help) error
+
+// RenderHelp implements HelpRenderer.
+func (f HelpRendererFunc) RenderHelp(w io.Writer, h Help) error {
+	return f(w, h)
+}
+
+// DefaultHelpRenderer is the HelpRenderer used by Group if no custom
+// HelpRenderer was provided.
+var DefaultHelpRenderer HelpRenderer = HelpRendererFunc(renderHelp)
+
+// ErrInvalidColorMode is returned when an unknown --color mode is requested.
+const ErrInvalidColorMode Error = "invalid color mode"
+
+// Usages returns the usage information of the FlagSet's flags, wrapped at the
+// provided width if larger than zero. Hidden flags are only included if
+// showHidden is set.
+//
+// The defaults of secret flags are redacted and the environment variables
+// secret flags can be read from are listed.
+func (f *FlagSet) Usages(width int, showHidden bool) string {
+	fs := pflag.NewFlagSet(f.Name, pflag.ContinueOnError)
+	fs.SortFlags = f.SortFlags
+	f.VisitAll(func(flag *pflag.Flag) {
+		cp := *flag
+		if showHidden {
+			cp.Hidden = false
+		}
+		if s, ok := flag.Value.(secret); ok {
+			// unwrap the Value so pflag recognizes zero defaults
+			cp.Value = s.secret().Value
+			if !zeroDefault(flag) {
+				cp.DefValue = redacted
+			}
+			if env := secretEnv(flag); env != "" {
+				cp.Usage += " (env $" + env + ")"
+			}
+		}
+		fs.AddFlag(&cp)
+	})
+	return fs.FlagUsagesWrapped(width)
+}
+
+func renderHelp(w io.Writer, h Help) error {
+	au := color.NewAurora(h.Color)
+	fmt.Fprintln(w, au.Cyan(au.Bold(fmt.Sprintf("Usage of %s:", h.Name))))
+	if h.Args != "" {
+		fmt.Fprintf(w, "  %s [flags] %s\n\n", h.Name, h.Args)
+	}
+	if h.HelpText != "" {
+		fmt.Fprintf(w, "%s\n", wrap(h.HelpText, h.Width))
+	}
+	if len(h.Commands) > 0 {
+		fmt.Fprintf(w, "%s\n\n", au.Cyan(au.Bold("Commands:")))
+		var pad int
+		for _, cmd := range h.Commands {
+			if len(cmd.Name) > pad {
+				pad = len(cmd.Name)
+			}
+		}
+		for _, cmd := range h.Commands {
+			fmt.Fprintf(w, "  %-*s   %s\n", pad, cmd.Name, firstLine(cmd.HelpText))
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "%s\n\n", au.Cyan(au.Bold("Flags:")))
+	for _, fs := range h.FlagSets {
+		usages := fs.Usages(h.Width, h.ShowHidden)
+		if usages == "" {
+			continue
+		}
+		fmt.Fprintf(w, "%s\n%s\n", au.Cyan("* "+fs.Name), usages)
+	}
+	for _, s := range h.Sections {
+		fmt.Fprintf(w, "%s\n%s\n\n", au.Cyan(au.Bold(s.Title+":")),
+			wrap(strings.TrimRight(s.Body, "\n"), h.Width))
+	}
+	return nil
+}
+
+// wrap wraps the lines of text longer than width at word boundaries, keeping
+// the indentation of the original line.
+func wrap(text string, width int) string {
+	if width <= 0 {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	out := make([]string, 0, len(lines))
+	for _, line := range lines {
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		words := strings.Fields(line)
+		if len(line) <= width || len(words) == 0 {
+			out = append(out, line)
+			continue
+		}
+		cur := indent + words[0]
+		for _, word := range words[1:] {
+			if len(cur)+1+len(word) > width {
+				out = append(out, cur)
+				cur = indent + word
+				continue
+			}
+			cur += " " + word
+		}
+		out = append(out, cur)
+	}
+	return strings.Join(out, "\n")
+}
+
+// renderHelp renders the help output using the configured HelpRenderer.
+func (g *Group) renderHelp(w io.Writer) error {
+	useColor, err := colorEnabled(g.opts.color, w)
+	if err != nil {
+		return err
+	}
+	h := Help{
+		Name:       g.usageName(),
+		Args:       g.argsUsage(),
+		HelpText:   g.helpText(),
+		Sections:   g.HelpSections,
+		ShowHidden: g.opts.showHelpAll,
+		Color:      useColor,
+		Width:      terminalWidth(w),
+	}
+	if g.cmd == nil {
+		for _, cmd := range g.cmds {
+			h.Commands = append(h.Commands, HelpCommand{Name: cmd.name, HelpText: cmd.helpText})
+		}
+	}
+	for _, fs := range append([]*FlagSet{g.gFS}, g.fs...) {
+		if fs != nil {
+			h.FlagSets = append(h.FlagSets, fs)
+		}
+	}
+	r := g.HelpRenderer
+	if r == nil {
+		r = DefaultHelpRenderer
+	}
+	return r.RenderHelp(w, h)
+}
+
+// colorEnabled decides if colored output is to be used, based on the requested
+// mode, the NO_COLOR convention (https://no-color.org) and TTY detection.
+func colorEnabled(mode string, w io.Writer) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "", "auto":
+		if os.Getenv("NO_COLOR") != "" {
+			return false, nil
+		}
+		return isTerminal(w), nil
+	default:
+		return false, fmt.Errorf("%w: %q (supported: auto, always, never)",
+			ErrInvalidColorMode, mode)
+	}
+}
+
+// isTerminal returns true if w is a character device.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// terminalWidth returns the width to wrap the help output at. The COLUMNS
+// environment variable takes precedence over the detected terminal width.
+// Output to non terminals is not wrapped unless COLUMNS is set.
+func terminalWidth(w io.Writer) int {
+	if cols, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && cols > 0 {
+		return cols
+	}
+	if f, ok := w.(*os.File); ok && isTerminal(w) {
+		if cols := ttyWidth(f); cols > 0 {
+			return cols
+		}
+		return 80
+	}
+	return 0
+}
@@ -0,0 +1,114 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/tetratelabs/telemetry"
+
+	"github.com/tetratelabs/run"
+)
+
+func TestHelpRenderer(t *testing.T) {
+	for _, tt := range []struct {
+		args    []string
+		env     map[string]string
+		want    []string
+		notWant []string
+	}{
+		{
+			args:    []string{"--help"},
+			want:    []string{"Usage of mytool:", "Examples:\n  mytool --mode slow\n"},
+			notWant: []string{"\x1b[", "--show-rungroup-units"},
+		},
+		{
+			args: []string{"--help-all", "--color=always"},
+			want: []string{"\x1b[", "--show-rungroup-units", "--completion"},
+		},
+		{
+			args:    []string{"--help", "--color", "always"},
+			env:     map[string]string{"NO_COLOR": "1"},
+			want:    []string{"\x1b["},
+			notWant: []string{"--show-rungroup-units"},
+		},
+		{
+			args:    []string{"-h"},
+			env:     map[string]string{"NO_COLOR": "1", "COLUMNS": "30"},
+			want:    []string{"mytool is a tool with a long\ndescription\n"},
+			notWant: []string{"\x1b["},
+		},
+	} {
+		for k, v := range tt.env {
+			t.Setenv(k, v)
+		}
+		g := run.Group{
+			Name:     "mytool",
+			HelpText: "mytool is a tool with a long description",
+			HelpSections: []run.HelpSection{
+				{Title: "Examples", Body: "  mytool --mode slow\n"},
+			},
+			Logger: telemetry.NoopLogger(),
+		}
+		g.Register(&completerConfig{})
+
+		var err error
+		have := captureStdout(t, func() { err = g.RunConfig(tt.args...) })
+		if err != run.ErrBailEarlyRequest {
+			t.Errorf("%v: expected bail early request, got %v", tt.args, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(have, want) {
+				t.Errorf("%v: expected help to contain %q:\n%s", tt.args, want, have)
+			}
+		}
+		for _, notWant := range tt.notWant {
+			if strings.Contains(have, notWant) {
+				t.Errorf("%v: expected help to not contain %q:\n%s", tt.args, notWant, have)
+			}
+		}
+	}
+}
+
+func TestCustomHelpRenderer(t *testing.T) {
+	var (
+		help run.Help
+		g    = run.Group{
+			Name:   "mytool",
+			Logger: telemetry.NoopLogger(),
+			HelpRenderer: run.HelpRendererFunc(func(_ io.Writer, h run.Help) error {
+				help = h
+				return nil
+			}),
+		}
+	)
+	g.Register(&completerConfig{})
+	g.RegisterCommand("serve", "start the server")
+
+	if err := g.RunConfig("--help-all", "--color", "never"); err != run.ErrBailEarlyRequest {
+		t.Errorf("expected bail early request, got %v", err)
+	}
+	if !help.ShowHidden || help.Color || len(help.FlagSets) != 2 || len(help.Commands) != 1 {
+		t.Errorf("unexpected help details: %+v", help)
+	}
+
+	g = run.Group{Logger: telemetry.NoopLogger()}
+	if err := g.RunConfig("--help", "--color", "sometimes"); !errors.Is(err, run.ErrInvalidColorMode) {
+		t.Errorf("expected invalid color mode error, got %v", err)
+	}
+}
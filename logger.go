@@ -0,0 +1,171 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/tetratelabs/telemetry"
+
+	"github.com/tetratelabs/run/pkg/log"
+)
+
+// LoggerSetter is an extension interface that Units can implement to receive
+// a Logger scoped to their name. If the Group Logger supports named scopes
+// (like the default pkg/log Logger), the level of each scope can be set
+// independently through the --log-scope-level flag, e.g.
+// --log-scope-level=xds:debug,db:error. Otherwise the Unit receives the Group
+// Logger with the scope name attached to it.
+//
+// SetLogger is called before the Initialize phase, or before the PreRunner
+// phase for Units registered after the Config phase.
+type LoggerSetter interface {
+	// Unit is embedded for Group registration and identification
+	Unit
+	SetLogger(l telemetry.Logger)
+}
+
+// LoggerProvider is an extension interface that Config Units can implement to
+// provide the Group Logger, like the Unit found in pkg/logconfig. The Logger of
+// the first registered LoggerProvider replaces the Group Logger before the
+// Initialize phase. As the LoggerProvider is expected to configure its Logger
+// through its own flags in the Config phase, the Group omits its --log-* flags.
+// If the LoggerProvider implements io.Closer, it is closed after the final log
+// line of Run.
+type LoggerProvider interface {
+	Config
+	Logger() telemetry.Logger
+}
+
+// scopedLogger is implemented by Loggers supporting named scopes with their
+// own levels.
+type scopedLogger interface {
+	Scope(name string) telemetry.Logger
+	SetScopeLevel(name string, level telemetry.Level)
+}
+
+// loggerProvider returns the first registered LoggerProvider, if any.
+func (g *Group) loggerProvider() LoggerProvider {
+	for _, c := range g.c {
+		// a Config might have been de-registered
+		if p, ok := c.(LoggerProvider); ok {
+			return p
+		}
+	}
+	return nil
+}
+
+// scopeLogger returns the Logger for the named scope.
+func (g *Group) scopeLogger(name string) telemetry.Logger {
+	if s, ok := g.Logger.(scopedLogger); ok {
+		return s.Scope(name)
+	}
+	return g.Logger.With("scope", name)
+}
+
+// setLoggers provides the registered LoggerSetter Units with their scoped
+// Logger.
+func (g *Group) setLoggers() {
+	for idx, ls := range g.l {
+		// a LoggerSetter might have been de-registered
+		if ls != nil {
+			ls.SetLogger(g.scopeLogger(ls.Name()))
+			// don't call again
+			g.l[idx] = nil
+		}
+	}
+}
+
+// applyScopeLevels sets the scope levels requested through the
+// --log-scope-level flag, formatted as scope:level pairs.
+func (g *Group) applyScopeLevels(s scopedLogger, pairs []string) error {
+	levels, err := log.ParseScopeLevels(pairs)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidLogLevel, err)
+	}
+	for name, lvl := range levels {
+		s.SetScopeLevel(name, lvl)
+	}
+	return nil
+}
+
+// openLogFile directs the output of the built-in Logger to the file requested
+// through the --log-file flags. An already opened log file is kept if its
+// configuration did not change.
+func (g *Group) openLogFile() error {
+	cfg := g.opts.logFile
+	cfg.MaxSize = int64(g.opts.logFileSize) << 20
+	if g.logFile != nil && g.logFile.Config() == cfg {
+		return nil
+	}
+	f, err := log.OpenFile(cfg)
+	if err != nil {
+		return err
+	}
+	g.Logger.(*log.Logger).SetOutput(f)
+	if g.logFile != nil {
+		_ = g.logFile.Close()
+	}
+	g.logFile = f
+	return nil
+}
+
+// closeLogOutput flushes and closes the log file, if any, directing the output
+// of the built-in Logger back to stderr. It also closes a LoggerProvider
+// implementing io.Closer.
+func (g *Group) closeLogOutput() {
+	if c, ok := g.loggerProvider().(io.Closer); ok {
+		_ = c.Close()
+	}
+	if g.logFile == nil {
+		return
+	}
+	g.Logger.(*log.Logger).SetOutput(nil)
+	_ = g.logFile.Close()
+	g.logFile = nil
+}
+
+// logFileReopener is a ServiceContext reopening the log file when receiving
+// a SIGHUP, allowing external tools like logrotate to move it. It is only used
+// on platforms providing SIGHUP.
+type logFileReopener struct {
+	g *Group
+}
+
+func (r *logFileReopener) Name() string {
+	return "log-file"
+}
+
+func (r *logFileReopener) ServeContext(ctx context.Context) error {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, logReopenSignal)
+	defer signal.Stop(sig)
+	for {
+		select {
+		case <-sig:
+			if err := r.g.logFile.Reopen(); err != nil {
+				r.g.Logger.Error("log file reopen", err, "path", r.g.logFile.Config().Path)
+				continue
+			}
+			r.g.Logger.Debug("log file reopened", "path", r.g.logFile.Config().Path)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
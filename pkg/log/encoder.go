@@ -0,0 +1,215 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/tetratelabs/telemetry"
+)
+
+// Format holds the output format of a Logger.
+type Format string
+
+// Supported output formats.
+const (
+	// FormatText writes space separated key/value pairs through the standard
+	// library logger. This is the default format.
+	FormatText Format = "text"
+	// FormatLogfmt writes logfmt lines with RFC3339Nano timestamps.
+	FormatLogfmt Format = "logfmt"
+	// FormatJSON writes JSON lines with RFC3339Nano timestamps.
+	FormatJSON Format = "json"
+)
+
+// FromFormat returns the Format corresponding to the given string
+// representation.
+func FromFormat(format string) (Format, bool) {
+	switch f := Format(format); f {
+	case FormatText, FormatLogfmt, FormatJSON:
+		return f, true
+	}
+	return "", false
+}
+
+// record holds a single log line to encode.
+type record struct {
+	time     time.Time
+	level    telemetry.Level
+	msg      string
+	err      error
+	keyValue []interface{}
+}
+
+// encodeText encodes the record in the legacy text format, to be written
+// through the standard library logger.
+func encodeText(r record) []byte {
+	args := []interface{}{
+		r.time.Format("2006-01-02 15:04:05.000000  "),
+		"msg", r.msg, "level", r.level.String(),
+	}
+	if r.level == telemetry.LevelError {
+		args = append(args, "error", errString(r.err))
+	}
+	args = append(args, r.keyValue...)
+	return []byte(fmt.Sprintln(args...))
+}
+
+// encodeLogfmt encodes the record as a logfmt line.
+func encodeLogfmt(r record) []byte {
+	var buf bytes.Buffer
+	writeLogfmt(&buf, "time", r.time.Format(time.RFC3339Nano))
+	buf.WriteByte(' ')
+	writeLogfmt(&buf, "level", r.level.String())
+	buf.WriteByte(' ')
+	writeLogfmt(&buf, "msg", r.msg)
+	if r.level == telemetry.LevelError {
+		buf.WriteByte(' ')
+		writeLogfmt(&buf, "error", errString(r.err))
+	}
+	for idx := 0; idx < len(r.keyValue); idx += 2 {
+		buf.WriteByte(' ')
+		key, value := keyValue(r.keyValue, idx)
+		writeLogfmt(&buf, key, stringValue(value))
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+func writeLogfmt(buf *bytes.Buffer, key, value string) {
+	buf.WriteString(logfmtKey(key))
+	buf.WriteByte('=')
+	if needsQuoting(value) {
+		buf.WriteString(strconv.Quote(value))
+		return
+	}
+	buf.WriteString(value)
+}
+
+// logfmtKey strips the characters not allowed in logfmt keys.
+func logfmtKey(key string) string {
+	k := []rune(key)
+	out := k[:0]
+	for _, r := range k {
+		if r > ' ' && r != '=' && r != '"' && r != utf8.RuneError {
+			out = append(out, r)
+		}
+	}
+	if len(out) == 0 {
+		return "_"
+	}
+	return string(out)
+}
+
+func needsQuoting(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError || !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeJSON encodes the record as a JSON line.
+func encodeJSON(r record) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	writeJSON(&buf, "time", r.time.Format(time.RFC3339Nano))
+	buf.WriteByte(',')
+	writeJSON(&buf, "level", r.level.String())
+	buf.WriteByte(',')
+	writeJSON(&buf, "msg", r.msg)
+	if r.level == telemetry.LevelError {
+		buf.WriteByte(',')
+		writeJSON(&buf, "error", errString(r.err))
+	}
+	for idx := 0; idx < len(r.keyValue); idx += 2 {
+		buf.WriteByte(',')
+		key, value := keyValue(r.keyValue, idx)
+		writeJSON(&buf, key, jsonValue(value))
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+func writeJSON(buf *bytes.Buffer, key string, value interface{}) {
+	k, _ := json.Marshal(key)
+	buf.Write(k)
+	buf.WriteByte(':')
+	v, err := json.Marshal(value)
+	if err != nil {
+		v, _ = json.Marshal(fmt.Sprintf("%+v", value))
+	}
+	buf.Write(v)
+}
+
+// jsonValue returns the value to marshal for the provided log value, keeping
+// JSON native types and using the string representation of errors and
+// fmt.Stringer implementations.
+func jsonValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case nil, bool, string, json.Marshaler,
+		int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64:
+		return t
+	case error:
+		return t.Error()
+	case fmt.Stringer:
+		return t.String()
+	}
+	return v
+}
+
+// stringValue returns the string representation of a log value.
+func stringValue(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "<nil>"
+	case string:
+		return t
+	case error:
+		return t.Error()
+	case fmt.Stringer:
+		return t.String()
+	}
+	return fmt.Sprintf("%+v", v)
+}
+
+// keyValue returns the key/value pair found at idx. Non string keys are
+// converted and a missing value for the last key is marked as such.
+func keyValue(keyValues []interface{}, idx int) (string, interface{}) {
+	key := stringValue(keyValues[idx])
+	if idx+1 >= len(keyValues) {
+		return key, "(MISSING)"
+	}
+	return key, keyValues[idx+1]
+}
+
+func errString(err error) string {
+	if err == nil {
+		return "<nil>"
+	}
+	return err.Error()
+}
@@ -0,0 +1,280 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat holds the timestamp format appended to rotated files.
+const backupTimeFormat = "20060102T150405.000"
+
+// FileConfig holds the configuration of a File.
+type FileConfig struct {
+	// Path holds the location of the log file.
+	Path string
+	// MaxSize holds the size in bytes after which the file is rotated. Size
+	// based rotation is disabled if not larger than zero.
+	MaxSize int64
+	// MaxAge holds the duration after which the file is rotated, counting
+	// from the moment it was opened. Age based rotation is disabled if not
+	// larger than zero.
+	MaxAge time.Duration
+	// MaxBackups holds the number of rotated files to keep. All rotated files
+	// are kept if not larger than zero.
+	MaxBackups int
+	// Compress enables gzip compression of rotated files.
+	Compress bool
+}
+
+// File is an io.WriteCloser writing to a log file with size and age based
+// rotation. Rotated files are renamed to the log file path with a timestamp
+// suffix, e.g. app.log.20221018T150405.000, and optionally compressed in the
+// background. File is safe for concurrent use and can be used as the output
+// of a Logger through SetOutput.
+//
+// To cooperate with external tools like logrotate, call Reopen after the log
+// file was moved, e.g. when receiving a SIGHUP.
+type File struct {
+	cfg FileConfig
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+
+	// bg serializes the compression and pruning of rotated files
+	bg sync.Mutex
+	wg sync.WaitGroup
+}
+
+// OpenFile opens the log file described by cfg for appending, creating it
+// and its parent directories if needed.
+func OpenFile(cfg FileConfig) (*File, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("log file: path is required")
+	}
+	f := &File{cfg: cfg}
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0o755); err != nil {
+		return nil, fmt.Errorf("log file: %w", err)
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Config returns the configuration of the File.
+func (f *File) Config() FileConfig {
+	return f.cfg
+}
+
+// Write implements io.Writer, rotating the file first if the write would
+// exceed MaxSize or the file is older than MaxAge.
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.f == nil {
+		return 0, os.ErrClosed
+	}
+	if f.size > 0 && f.needsRotation(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.f.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Rotate rotates the log file regardless of its size and age.
+func (f *File) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.f == nil {
+		return os.ErrClosed
+	}
+	return f.rotate()
+}
+
+// Reopen closes and reopens the log file at its configured path. Use it after
+// the log file was moved by an external tool.
+func (f *File) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.f == nil {
+		return os.ErrClosed
+	}
+	if err := f.f.Close(); err != nil {
+		return fmt.Errorf("log file: %w", err)
+	}
+	f.f = nil
+	return f.open()
+}
+
+// Sync flushes the log file to stable storage.
+func (f *File) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.f == nil {
+		return os.ErrClosed
+	}
+	return f.f.Sync()
+}
+
+// Close flushes and closes the log file and waits for the compression of
+// rotated files to finish.
+func (f *File) Close() error {
+	f.mu.Lock()
+	var err error
+	if f.f != nil {
+		if err = f.f.Sync(); err == nil {
+			err = f.f.Close()
+		} else {
+			_ = f.f.Close()
+		}
+		f.f = nil
+	}
+	f.mu.Unlock()
+	f.wg.Wait()
+	return err
+}
+
+func (f *File) needsRotation(n int64) bool {
+	if f.cfg.MaxSize > 0 && f.size+n > f.cfg.MaxSize {
+		return true
+	}
+	return f.cfg.MaxAge > 0 && time.Since(f.opened) >= f.cfg.MaxAge
+}
+
+// open opens the log file. The mutex must be held.
+func (f *File) open() error {
+	file, err := os.OpenFile(f.cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("log file: %w", err)
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("log file: %w", err)
+	}
+	f.f, f.size, f.opened = file, fi.Size(), time.Now()
+	return nil
+}
+
+// rotate moves the current log file aside and opens a new one. The mutex must
+// be held.
+func (f *File) rotate() error {
+	if err := f.f.Close(); err != nil {
+		return fmt.Errorf("log file: %w", err)
+	}
+	f.f = nil
+	backup := f.cfg.Path + "." + time.Now().Format(backupTimeFormat)
+	if err := os.Rename(f.cfg.Path, backup); err != nil {
+		// keep logging to the current file
+		if oErr := f.open(); oErr != nil {
+			return oErr
+		}
+		return fmt.Errorf("log file: %w", err)
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		f.bg.Lock()
+		defer f.bg.Unlock()
+		if f.cfg.Compress {
+			_ = compress(backup)
+		}
+		f.prune()
+	}()
+	return nil
+}
+
+// prune removes the oldest rotated files exceeding MaxBackups.
+func (f *File) prune() {
+	if f.cfg.MaxBackups <= 0 {
+		return
+	}
+	backups := f.backups()
+	if len(backups) <= f.cfg.MaxBackups {
+		return
+	}
+	for _, name := range backups[:len(backups)-f.cfg.MaxBackups] {
+		_ = os.Remove(name)
+	}
+}
+
+// backups returns the rotated files of the log file, oldest first.
+func (f *File) backups() []string {
+	matches, _ := filepath.Glob(f.cfg.Path + ".*")
+	var backups []string
+	for _, name := range matches {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(name, f.cfg.Path+"."), ".gz")
+		if _, err := time.Parse(backupTimeFormat, suffix); err == nil {
+			backups = append(backups, name)
+		}
+	}
+	// timestamps sort lexically, ignore the compression suffix
+	sort.Slice(backups, func(i, j int) bool {
+		return strings.TrimSuffix(backups[i], ".gz") < strings.TrimSuffix(backups[j], ".gz")
+	})
+	return backups
+}
+
+// compress gzips the file at path and removes the original.
+func compress(path string) (err error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(path + ".gz")
+		}
+	}()
+	zw := gzip.NewWriter(out)
+	if _, err = io.Copy(zw, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err = zw.Close(); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+	_ = in.Close()
+	return os.Remove(path)
+}
+
+var _ io.WriteCloser = (*File)(nil)
@@ -0,0 +1,141 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "app.log")
+	f, err := OpenFile(FileConfig{Path: path, MaxSize: 20, MaxBackups: 2, Compress: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	line := []byte("0123456789abcdef\n")
+	for i := 0; i < 4; i++ {
+		if _, err = f.Write(line); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		// avoid backups sharing a timestamp
+		time.Sleep(2 * time.Millisecond)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = f.Write(line); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("expected closed error, got %v", err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want, have := string(line), string(b); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+
+	backups := f.backups()
+	if want, have := 2, len(backups); want != have {
+		t.Fatalf("want %d backups, have %d: %v", want, have, backups)
+	}
+	for _, name := range backups {
+		if !strings.HasSuffix(name, ".gz") {
+			t.Errorf("expected compressed backup, got %s", name)
+			continue
+		}
+		r, err := os.Open(name)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		b, err = io.ReadAll(zr)
+		_ = r.Close()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want, have := string(line), string(b); want != have {
+			t.Errorf("want %q, have %q", want, have)
+		}
+	}
+}
+
+func TestFileAgeRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	f, err := OpenFile(FileConfig{Path: path, MaxAge: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	_, _ = f.Write([]byte("first\n"))
+	_, _ = f.Write([]byte("second\n"))
+	if want, have := 0, len(f.backups()); want != have {
+		t.Fatalf("want %d backups, have %d", want, have)
+	}
+	time.Sleep(30 * time.Millisecond)
+	_, _ = f.Write([]byte("third\n"))
+	if want, have := 1, len(f.backups()); want != have {
+		t.Fatalf("want %d backups, have %d", want, have)
+	}
+}
+
+func TestFileReopen(t *testing.T) {
+	var (
+		dir   = t.TempDir()
+		path  = filepath.Join(dir, "app.log")
+		moved = filepath.Join(dir, "app.log.1")
+	)
+	f, err := OpenFile(FileConfig{Path: path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	l := New()
+	l.SetOutput(f)
+	l.SetFormat(FormatLogfmt)
+	l.Info("before")
+
+	// emulate logrotate
+	if err = os.Rename(path, moved); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	l.Info("moved")
+	if err = f.Reopen(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	l.Info("after")
+
+	b, _ := os.ReadFile(moved)
+	if !strings.Contains(string(b), "msg=before") || !strings.Contains(string(b), "msg=moved") {
+		t.Errorf("unexpected content of moved file: %q", b)
+	}
+	b, _ = os.ReadFile(path)
+	if !strings.Contains(string(b), "msg=after") || strings.Contains(string(b), "msg=moved") {
+		t.Errorf("unexpected content of reopened file: %q", b)
+	}
+}
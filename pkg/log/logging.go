@@ -16,7 +16,10 @@ package log
 
 import (
 	"context"
+	"io"
 	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/tetratelabs/telemetry"
@@ -25,38 +28,160 @@ import (
 // Logger holds a very bare bones minimal implementation of telemetry.Logging.
 // It is used by run.Group when not wired up with an explicit Logging
 // implementation.
+//
+// The log level and output are shared between a Logger and all Loggers
+// derived from it through With and Clone, and can be safely changed at
+// runtime. Use New to create a Logger; the zero value logs at
+// telemetry.LevelInfo in FormatText, but changes are not propagated to Loggers
+// derived from it before the first SetLevel, SetOutput or SetFormat call.
 type Logger struct {
-	args []interface{}
+	args       []interface{}
+	ctx        context.Context
+	level      *int32
+	out        *output
+	scopes     *scopes
+	scopeLevel *int32
+	forced     *int32
+	metric     telemetry.Metric
 }
 
-func (l *Logger) Debug(msg string, keyValuePairs ...interface{}) {
-	args := []interface{}{
-		time.Now().Format("2006-01-02 15:04:05.000000  "),
-		"msg", msg, "level", "debug",
+// output holds the destination and format of log lines.
+type output struct {
+	mu      sync.Mutex
+	w       io.Writer
+	format  Format
+	limiter *limiter
+}
+
+// New returns a new Logger logging at telemetry.LevelInfo in FormatText.
+func New() *Logger {
+	lvl, forced := int32(telemetry.LevelInfo), int32(inheritLevel)
+	return &Logger{
+		level:  &lvl,
+		forced: &forced,
+		scopes: &scopes{levels: make(map[string]*int32)},
+		out:    &output{format: FormatText},
 	}
-	args = append(args, l.args...)
-	args = append(args, keyValuePairs...)
-	log.Println(args...)
+}
+
+func (l *Logger) Debug(msg string, keyValuePairs ...interface{}) {
+	l.emit(telemetry.LevelDebug, msg, nil, keyValuePairs)
 }
 
 func (l *Logger) Info(msg string, keyValuePairs ...interface{}) {
-	args := []interface{}{
-		time.Now().Format("2006-01-02 15:04:05.000000  "),
-		"msg", msg, "level", "info",
-	}
-	args = append(args, l.args...)
-	args = append(args, keyValuePairs...)
-	log.Println(args...)
+	l.emit(telemetry.LevelInfo, msg, nil, keyValuePairs)
 }
 
 func (l *Logger) Error(msg string, err error, keyValuePairs ...interface{}) {
-	args := []interface{}{
-		time.Now().Format("2006-01-02 15:04:05.000000  "),
-		"msg", msg, "level", "error", "error", err.Error(),
+	l.emit(telemetry.LevelError, msg, err, keyValuePairs)
+}
+
+// SetOutput sets the destination of the Logger and all Loggers derived from
+// it. If w is nil, log lines are written to the standard library logger's
+// output.
+func (l *Logger) SetOutput(w io.Writer) {
+	o := l.output(true)
+	o.mu.Lock()
+	o.w = w
+	o.mu.Unlock()
+}
+
+// SetFormat sets the output format of the Logger and all Loggers derived from
+// it.
+func (l *Logger) SetFormat(format Format) {
+	o := l.output(true)
+	o.mu.Lock()
+	o.format = format
+	o.mu.Unlock()
+}
+
+// Format returns the current output format.
+func (l *Logger) Format() Format {
+	o := l.output(false)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.format
+}
+
+// keyValues returns the key/value pairs of a log line, in order: found in the
+// Logger's Context, added to the Logger and provided to the logging method.
+func (l *Logger) keyValues(keyValuePairs []interface{}) []interface{} {
+	var fromContext []interface{}
+	if l.ctx != nil {
+		fromContext = telemetry.KeyValuesFromContext(l.ctx)
+	}
+	kv := make([]interface{}, 0, len(fromContext)+len(l.args)+len(keyValuePairs))
+	kv = append(kv, fromContext...)
+	kv = append(kv, l.args...)
+	return append(kv, keyValuePairs...)
+}
+
+// stdOutput is used by zero value Loggers until their output is changed.
+var stdOutput = output{format: FormatText}
+
+// output returns the output of the Logger, allocating a dedicated one for
+// zero value Loggers if requested.
+func (l *Logger) output(allocate bool) *output {
+	switch {
+	case l.out != nil:
+		return l.out
+	case allocate:
+		l.out = &output{format: FormatText}
+		return l.out
+	}
+	return &stdOutput
+}
+
+// emit encodes and writes a log line if enabled for the provided level.
+func (l *Logger) emit(level telemetry.Level, msg string, err error, keyValuePairs []interface{}) {
+	if l.metric != nil && level != telemetry.LevelDebug {
+		if l.ctx != nil {
+			l.metric.RecordContext(l.ctx, 1)
+		} else {
+			l.metric.Increment()
+		}
+	}
+	if !l.enabled(level) {
+		return
+	}
+	r := record{
+		time:     time.Now(),
+		level:    level,
+		msg:      msg,
+		err:      err,
+		keyValue: l.keyValues(keyValuePairs),
+	}
+
+	o := l.output(false)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.limiter != nil && !o.limiter.allow(o, r) {
+		return
+	}
+	o.write(r)
+}
+
+// write encodes and writes the record. The output's mutex must be held.
+func (o *output) write(r record) {
+	w := o.w
+	switch o.format {
+	case FormatLogfmt:
+		if w == nil {
+			w = log.Writer()
+		}
+		_, _ = w.Write(encodeLogfmt(r))
+	case FormatJSON:
+		if w == nil {
+			w = log.Writer()
+		}
+		_, _ = w.Write(encodeJSON(r))
+	default:
+		if w == nil {
+			_ = log.Output(4, string(encodeText(r)))
+			return
+		}
+		_, _ = w.Write(encodeText(r))
 	}
-	args = append(args, l.args...)
-	args = append(args, keyValuePairs...)
-	log.Println(args...)
 }
 
 func (l Logger) With(keyValuePairs ...interface{}) telemetry.Logger {
@@ -67,32 +192,105 @@ func (l Logger) With(keyValuePairs ...interface{}) telemetry.Logger {
 
 func (l *Logger) Clone() telemetry.Logger {
 	return &Logger{
-		args: append(([]interface{})(nil), l.args...),
+		args:       append(([]interface{})(nil), l.args...),
+		ctx:        l.ctx,
+		level:      l.level,
+		out:        l.out,
+		scopes:     l.scopes,
+		scopeLevel: l.scopeLevel,
+		forced:     l.forced,
+		metric:     l.metric,
 	}
 }
 
+// Level returns the current log level.
 func (l *Logger) Level() telemetry.Level {
-	// not used by run.Group
-	return telemetry.LevelNone
+	if l.forced != nil {
+		if lvl := atomic.LoadInt32(l.forced); lvl != inheritLevel {
+			return telemetry.Level(lvl)
+		}
+	}
+	if l.scopeLevel != nil {
+		if lvl := atomic.LoadInt32(l.scopeLevel); lvl != inheritLevel {
+			return telemetry.Level(lvl)
+		}
+	}
+	if l.level == nil {
+		return telemetry.LevelInfo
+	}
+	return telemetry.Level(atomic.LoadInt32(l.level))
 }
 
-func (l *Logger) SetLevel(telemetry.Level) {
-	// not used by run.Group
+// SetLevel sets the log level of the Logger and all Loggers derived from it.
+// For scoped Loggers the level of the scope is set.
+func (l *Logger) SetLevel(level telemetry.Level) {
+	if l.scopeLevel != nil {
+		atomic.StoreInt32(l.scopeLevel, int32(level))
+		return
+	}
+	if l.level == nil {
+		lvl := int32(level)
+		l.level = &lvl
+		return
+	}
+	atomic.StoreInt32(l.level, int32(level))
 }
 
-func (l *Logger) KeyValuesToContext(ctx context.Context, _ ...interface{}) context.Context {
-	// not used by run.Group
-	return ctx
+// ForceLevel makes the Logger, all Loggers derived from it and all scopes log
+// at the provided level, regardless of the levels set through SetLevel and
+// SetScopeLevel, until ClearForcedLevel is called. Use it to temporarily
+// enable debug logging without losing the configured levels.
+func (l *Logger) ForceLevel(level telemetry.Level) {
+	if l.forced == nil {
+		forced := int32(level)
+		l.forced = &forced
+		return
+	}
+	atomic.StoreInt32(l.forced, int32(level))
 }
 
-func (l *Logger) Context(_ context.Context) telemetry.Logger {
-	// not used by run.Group
-	return l
+// ClearForcedLevel reverts ForceLevel, restoring the configured levels.
+func (l *Logger) ClearForcedLevel() {
+	if l.forced != nil {
+		atomic.StoreInt32(l.forced, inheritLevel)
+	}
 }
 
-func (l *Logger) Metric(_ telemetry.Metric) telemetry.Logger {
-	// not used by run.Group
-	return l
+// ForcedLevel returns the level set through ForceLevel, if any.
+func (l *Logger) ForcedLevel() (telemetry.Level, bool) {
+	if l.forced == nil {
+		return telemetry.LevelNone, false
+	}
+	lvl := atomic.LoadInt32(l.forced)
+	return telemetry.Level(lvl), lvl != inheritLevel
+}
+
+func (l *Logger) enabled(level telemetry.Level) bool {
+	return level <= l.Level()
+}
+
+// KeyValuesToContext returns a copy of ctx holding the provided key/value
+// pairs in addition to the ones already stored. These are added to each line
+// logged by a Logger obtained through Context.
+func (l *Logger) KeyValuesToContext(ctx context.Context, keyValuePairs ...interface{}) context.Context {
+	return telemetry.KeyValuesToContext(ctx, keyValuePairs...)
+}
+
+// Context returns a new Logger adding the key/value pairs stored in ctx to
+// each log line.
+func (l *Logger) Context(ctx context.Context) telemetry.Logger {
+	newLogger := l.Clone().(*Logger)
+	newLogger.ctx = ctx
+	return newLogger
+}
+
+// Metric returns a new Logger incrementing the provided Metric for each Info
+// and Error line, regardless of the log level. Label values found in the
+// Logger's Context are applied to the Metric.
+func (l *Logger) Metric(m telemetry.Metric) telemetry.Logger {
+	newLogger := l.Clone().(*Logger)
+	newLogger.metric = m
+	return newLogger
 }
 
 var _ telemetry.Logger = (*Logger)(nil)
@@ -0,0 +1,431 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	stdlog "log"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+)
+
+func TestLevels(t *testing.T) {
+	var buf bytes.Buffer
+	stdlog.SetOutput(&buf)
+	defer stdlog.SetOutput(os.Stderr)
+
+	l := New()
+	child := l.With("unit", "test")
+	if want, have := telemetry.LevelInfo, child.Level(); want != have {
+		t.Fatalf("want level %v, have %v", want, have)
+	}
+
+	emit := func() []string {
+		buf.Reset()
+		child.Debug("debug line")
+		child.Info("info line")
+		child.Error("error line", errors.New("oops"))
+		var lines []string
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if line != "" {
+				lines = append(lines, line)
+			}
+		}
+		return lines
+	}
+
+	for _, tt := range []struct {
+		level telemetry.Level
+		lines int
+	}{
+		{telemetry.LevelInfo, 2},
+		{telemetry.LevelDebug, 3},
+		{telemetry.LevelError, 1},
+		{telemetry.LevelNone, 0},
+	} {
+		// level changes on the parent are shared with derived loggers
+		l.SetLevel(tt.level)
+		if have := emit(); len(have) != tt.lines {
+			t.Errorf("%v: want %d lines, have %d: %v", tt.level, tt.lines, len(have), have)
+		}
+	}
+
+	var zero Logger
+	if want, have := telemetry.LevelInfo, zero.Level(); want != have {
+		t.Errorf("zero value: want level %v, have %v", want, have)
+	}
+}
+
+func TestFormats(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		l   = New()
+	)
+	l.SetOutput(&buf)
+	l.SetLevel(telemetry.LevelDebug)
+	child := l.With("unit", "my unit", "count", 3)
+
+	l.SetFormat(FormatLogfmt)
+	child.Error("failed to start", errors.New("2 errors:\n* a\n* b"), "quoted", `say "hi"`, "empty", "", "odd")
+	line := buf.String()
+	for _, want := range []string{
+		" level=error msg=\"failed to start\" error=\"2 errors:\\n* a\\n* b\" unit=\"my unit\" count=3 ",
+		`quoted="say \"hi\"" empty="" odd=(MISSING)` + "\n",
+	} {
+		if !strings.Contains(line, want) {
+			t.Errorf("logfmt: expected %q in %q", want, line)
+		}
+	}
+	if !strings.HasPrefix(line, "time=") || strings.Count(line, "\n") != 1 {
+		t.Errorf("logfmt: unexpected line %q", line)
+	}
+
+	buf.Reset()
+	l.SetFormat(FormatJSON)
+	child.Debug("retrying", "delay", 2*time.Second, "ok", false)
+	var m map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatalf("json: invalid line %q: %v", buf.String(), err)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, m["time"].(string)); err != nil {
+		t.Errorf("json: invalid timestamp: %v", err)
+	}
+	delete(m, "time")
+	want := map[string]interface{}{
+		"level": "debug", "msg": "retrying", "unit": "my unit", "count": 3.0, "delay": "2s", "ok": false,
+	}
+	if !reflect.DeepEqual(want, m) {
+		t.Errorf("json: want %v, have %v", want, m)
+	}
+
+	buf.Reset()
+	l.SetFormat(FormatText)
+	child.Info("hello")
+	if want := "  msg hello level info unit my unit count 3\n"; !strings.HasSuffix(buf.String(), want) {
+		t.Errorf("text: expected suffix %q in %q", want, buf.String())
+	}
+}
+
+func TestContext(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		l   = New()
+	)
+	l.SetOutput(&buf)
+	l.SetFormat(FormatLogfmt)
+
+	ctx := l.KeyValuesToContext(context.Background(), "request", "r1")
+	ctx = l.KeyValuesToContext(ctx, "user", "u1")
+	l.With("unit", "api").Context(ctx).Info("handled", "status", 200)
+	if want := " msg=handled request=r1 user=u1 unit=api status=200\n"; !strings.HasSuffix(buf.String(), want) {
+		t.Errorf("expected suffix %q in %q", want, buf.String())
+	}
+
+	// loggers derived from a context aware logger keep the context
+	buf.Reset()
+	l.Context(ctx).With("unit", "db").Info("query")
+	if want := " msg=query request=r1 user=u1 unit=db\n"; !strings.HasSuffix(buf.String(), want) {
+		t.Errorf("expected suffix %q in %q", want, buf.String())
+	}
+}
+
+func TestScopes(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		l   = New()
+	)
+	l.SetOutput(&buf)
+	l.SetFormat(FormatLogfmt)
+	xds, db := l.Scope("xds"), l.Scope("db").With("table", "users")
+
+	count := func() int {
+		buf.Reset()
+		xds.Debug("xds debug")
+		db.Debug("db debug")
+		return strings.Count(buf.String(), "\n")
+	}
+
+	if want, have := 0, count(); want != have {
+		t.Errorf("inherited level: want %d lines, have %d", want, have)
+	}
+	l.SetScopeLevel("xds", telemetry.LevelDebug)
+	if want, have := 1, count(); want != have {
+		t.Errorf("xds at debug: want %d lines, have %d", want, have)
+	}
+	if !strings.Contains(buf.String(), "msg=\"xds debug\" scope=xds") {
+		t.Errorf("expected scope in %q", buf.String())
+	}
+	l.SetLevel(telemetry.LevelDebug)
+	xds.SetLevel(telemetry.LevelError)
+	if want, have := 1, count(); want != have {
+		t.Errorf("xds at error: want %d lines, have %d", want, have)
+	}
+	if want, have := map[string]telemetry.Level{"xds": telemetry.LevelError}, l.ScopeLevels(); !reflect.DeepEqual(want, have) {
+		t.Errorf("scope levels: want %v, have %v", want, have)
+	}
+	l.ResetScopeLevel("xds")
+	if want, have := 2, count(); want != have {
+		t.Errorf("xds reset: want %d lines, have %d", want, have)
+	}
+	if want, have := []string{"db", "xds"}, l.Scopes(); !reflect.DeepEqual(want, have) {
+		t.Errorf("scopes: want %v, have %v", want, have)
+	}
+}
+
+func TestConcurrentScopes(t *testing.T) {
+	var (
+		buf     bytes.Buffer
+		l       = New()
+		derived = l.With("k", "v")
+		wg      sync.WaitGroup
+	)
+	l.SetOutput(&buf)
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			l.Scope("xds").Debug("xds debug")
+		}()
+		go func() {
+			defer wg.Done()
+			derived.(*Logger).Scope("xds").Debug("xds debug")
+		}()
+	}
+	wg.Wait()
+
+	l.SetScopeLevel("xds", telemetry.LevelDebug)
+	derived.(*Logger).Scope("xds").Debug("xds debug")
+	l.Clone().(*Logger).Scope("xds").Debug("xds debug")
+	if want, have := 2, strings.Count(buf.String(), "\n"); want != have {
+		t.Errorf("derived scopes: want %d lines, have %d", want, have)
+	}
+}
+
+func TestParseScopeLevels(t *testing.T) {
+	have, err := ParseScopeLevels([]string{"xds:DEBUG", " db : warn", "a:b:none"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]telemetry.Level{
+		"xds": telemetry.LevelDebug,
+		"db":  telemetry.LevelInfo,
+		"a:b": telemetry.LevelNone,
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+
+	for pair, want := range map[string]string{
+		":debug":   `":debug" (expected scope:level)`,
+		"xds":      `"xds" (expected scope:level)`,
+		"xds:loud": `scope "xds": "loud" (supported: `,
+	} {
+		if _, err := ParseScopeLevels([]string{pair}); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: expected error containing %q, got %v", pair, want, err)
+		}
+	}
+}
+
+func TestForceLevel(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		l   = New()
+	)
+	l.SetOutput(&buf)
+	l.SetFormat(FormatLogfmt)
+	l.SetScopeLevel("db", telemetry.LevelError)
+	db := l.Scope("db")
+
+	count := func() int {
+		buf.Reset()
+		l.Debug("root debug")
+		db.Debug("db debug")
+		return strings.Count(buf.String(), "\n")
+	}
+
+	db.(*Logger).ForceLevel(telemetry.LevelDebug)
+	if want, have := 2, count(); want != have {
+		t.Errorf("forced debug: want %d lines, have %d", want, have)
+	}
+	if lvl, ok := l.ForcedLevel(); !ok || lvl != telemetry.LevelDebug {
+		t.Errorf("forced level: want %v, have %v (%t)", telemetry.LevelDebug, lvl, ok)
+	}
+	l.ClearForcedLevel()
+	if want, have := 0, count(); want != have {
+		t.Errorf("cleared: want %d lines, have %d", want, have)
+	}
+	if want, have := telemetry.LevelError, db.Level(); want != have {
+		t.Errorf("db level: want %v, have %v", want, have)
+	}
+	if _, ok := l.ForcedLevel(); ok {
+		t.Error("expected no forced level")
+	}
+}
+
+func TestConcurrentLevelChanges(t *testing.T) {
+	var (
+		wg sync.WaitGroup
+		l  = New()
+	)
+	stdlog.SetOutput(&bytes.Buffer{})
+	defer stdlog.SetOutput(os.Stderr)
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				l.SetLevel(telemetry.LevelNone)
+				l.SetLevel(telemetry.LevelDebug)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				l.Clone().Debug("line")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// lockedBuffer guards a bytes.Buffer written to by the rate limiter's timer.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestRateLimit(t *testing.T) {
+	var buf lockedBuffer
+	l := New()
+	l.SetOutput(&buf)
+	l.SetFormat(FormatLogfmt)
+	l.SetRateLimit(RateLimit{
+		Interval:     100 * time.Millisecond,
+		First:        2,
+		Thereafter:   3,
+		ExemptErrors: true,
+	})
+
+	child := l.With("unit", "retry")
+	for i := 0; i < 10; i++ {
+		child.Info("retrying")
+		child.Error("failed", errors.New("oops"))
+	}
+	child.Info("other line")
+
+	out := buf.String()
+	// lines 1, 2, 5 and 8 pass the limiter
+	if want, have := 4, strings.Count(out, "msg=retrying"); want != have {
+		t.Errorf("want %d sampled lines, have %d: %q", want, have, out)
+	}
+	if want, have := 10, strings.Count(out, "msg=failed"); want != have {
+		t.Errorf("want %d exempt error lines, have %d", want, have)
+	}
+	if !strings.Contains(out, "msg=\"other line\"") {
+		t.Errorf("expected other line to be logged: %q", out)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(buf.String(), "dropped=6") {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected summary of dropped lines: %q", buf.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// a new interval resets the counts
+	child.Info("retrying")
+	if want, have := 5, strings.Count(buf.String(), "msg=retrying"); want != have {
+		t.Errorf("want %d sampled lines, have %d", want, have)
+	}
+
+	// disabling rate limiting
+	l.SetRateLimit(RateLimit{})
+	for i := 0; i < 10; i++ {
+		child.Info("retrying")
+	}
+	if want, have := 15, strings.Count(buf.String(), "msg=retrying"); want != have {
+		t.Errorf("want %d lines, have %d", want, have)
+	}
+}
+
+// countingMetric counts the recorded values and the contexts they were
+// recorded with.
+type countingMetric struct {
+	telemetry.Metric
+	mu       sync.Mutex
+	value    float64
+	contexts int
+}
+
+func (m *countingMetric) Increment() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.value++
+}
+
+func (m *countingMetric) RecordContext(_ context.Context, value float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.value += value
+	m.contexts++
+}
+
+func TestMetric(t *testing.T) {
+	var buf bytes.Buffer
+	l := New()
+	l.SetOutput(&buf)
+	l.SetLevel(telemetry.LevelError)
+
+	m := &countingMetric{}
+	ml := l.Metric(m)
+	ml.Debug("debug line")
+	ml.Info("info line")
+	ml.Error("error line", errors.New("oops"))
+	ml.With("key", "value").Error("error line", errors.New("oops"))
+	ml.Context(context.Background()).Info("info line")
+	l.Info("no metric")
+
+	if want, have := 4.0, m.value; want != have {
+		t.Errorf("want metric value %v, have %v", want, have)
+	}
+	if want, have := 1, m.contexts; want != have {
+		t.Errorf("want %d context recordings, have %d", want, have)
+	}
+	if want, have := 2, strings.Count(buf.String(), "error line"); want != have {
+		t.Errorf("want %d logged lines, have %d", want, have)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+)
+
+// RateLimit holds the rate limiting and sampling configuration of a Logger.
+// Log lines are considered identical if they share their level and message.
+// Per Interval, the First identical lines are logged, after which only every
+// Thereafter-th line is logged. At the end of each Interval in which lines
+// were dropped, a summary line holding the number of dropped lines is logged.
+type RateLimit struct {
+	// Interval holds the period after which the line counts are reset. Rate
+	// limiting is disabled if not larger than zero.
+	Interval time.Duration
+	// First holds the number of identical lines logged per Interval before
+	// sampling starts.
+	First int
+	// Thereafter holds the sampling rate after the First lines, logging one
+	// out of Thereafter lines. If not larger than zero, all lines are
+	// dropped after the First lines.
+	Thereafter int
+	// ExemptErrors disables rate limiting of Error level lines.
+	ExemptErrors bool
+}
+
+// SetRateLimit sets the rate limiting and sampling configuration of the Logger
+// and all Loggers derived from it. Use the zero value to disable rate limiting.
+func (l *Logger) SetRateLimit(r RateLimit) {
+	o := l.output(true)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.limiter != nil && o.limiter.timer != nil {
+		o.limiter.timer.Stop()
+		o.limiter.summarize(o)
+	}
+	o.limiter = nil
+	if r.Interval > 0 {
+		o.limiter = &limiter{cfg: r, counts: make(map[limitKey]int)}
+	}
+}
+
+// limitKey identifies identical log lines.
+type limitKey struct {
+	level telemetry.Level
+	msg   string
+}
+
+// limiter tracks the line counts of the current interval.
+type limiter struct {
+	cfg     RateLimit
+	start   time.Time
+	counts  map[limitKey]int
+	dropped int
+	timer   *time.Timer
+}
+
+// allow returns true if the record is to be logged. The output's mutex must
+// be held.
+func (lim *limiter) allow(o *output, r record) bool {
+	if lim.cfg.ExemptErrors && r.level == telemetry.LevelError {
+		return true
+	}
+	if r.time.Sub(lim.start) >= lim.cfg.Interval {
+		lim.start = r.time
+		lim.counts = make(map[limitKey]int)
+	}
+	key := limitKey{level: r.level, msg: r.msg}
+	lim.counts[key]++
+	n := lim.counts[key]
+	if n <= lim.cfg.First ||
+		(lim.cfg.Thereafter > 0 && (n-lim.cfg.First)%lim.cfg.Thereafter == 0) {
+		return true
+	}
+	lim.dropped++
+	if lim.timer == nil {
+		// report the dropped lines at the end of the interval
+		lim.timer = time.AfterFunc(lim.start.Add(lim.cfg.Interval).Sub(r.time), func() {
+			o.mu.Lock()
+			defer o.mu.Unlock()
+			if o.limiter == lim {
+				lim.summarize(o)
+			}
+		})
+	}
+	return false
+}
+
+// summarize logs the number of dropped lines. The output's mutex must be held.
+func (lim *limiter) summarize(o *output) {
+	lim.timer = nil
+	if lim.dropped == 0 {
+		return
+	}
+	o.write(record{
+		time:     time.Now(),
+		level:    telemetry.LevelInfo,
+		msg:      "log lines dropped by rate limiter",
+		keyValue: []interface{}{"dropped", lim.dropped, "interval", lim.cfg.Interval},
+	})
+	lim.dropped = 0
+}
@@ -0,0 +1,130 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tetratelabs/telemetry"
+)
+
+// inheritLevel marks a scope without a level of its own.
+const inheritLevel = -1
+
+// scopes holds the levels of the named scopes of a Logger. It is allocated by
+// New and shared by all Loggers derived from it.
+type scopes struct {
+	mu     sync.Mutex
+	levels map[string]*int32
+}
+
+// level returns the level of the named scope, registering it if needed.
+func (s *scopes) level(name string) *int32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lvl, ok := s.levels[name]
+	if !ok {
+		v := int32(inheritLevel)
+		lvl = &v
+		s.levels[name] = lvl
+	}
+	return lvl
+}
+
+// Scope returns a Logger for the named scope, adding the scope name to each
+// log line. A scoped Logger logs at the level of the Logger it was derived
+// from, unless a level was set for the scope through SetScopeLevel or by
+// calling SetLevel on the scoped Logger. All Loggers of the same scope share
+// their level, which can be safely changed at runtime.
+func (l *Logger) Scope(name string) telemetry.Logger {
+	scoped := l.With("scope", name).(*Logger)
+	scoped.scopeLevel = scoped.scopes.level(name)
+	return scoped
+}
+
+// SetScopeLevel sets the level of the named scope.
+func (l *Logger) SetScopeLevel(name string, level telemetry.Level) {
+	atomic.StoreInt32(l.scopes.level(name), int32(level))
+}
+
+// ResetScopeLevel makes the named scope log at the level of the Logger it was
+// derived from again.
+func (l *Logger) ResetScopeLevel(name string) {
+	atomic.StoreInt32(l.scopes.level(name), inheritLevel)
+}
+
+// ScopeLevels returns the levels of the scopes having a level of their own.
+func (l *Logger) ScopeLevels() map[string]telemetry.Level {
+	levels := make(map[string]telemetry.Level)
+	l.scopes.mu.Lock()
+	defer l.scopes.mu.Unlock()
+	for name, lvl := range l.scopes.levels {
+		if v := atomic.LoadInt32(lvl); v != inheritLevel {
+			levels[name] = telemetry.Level(v)
+		}
+	}
+	return levels
+}
+
+// Scopes returns the names of the registered scopes.
+func (l *Logger) Scopes() []string {
+	l.scopes.mu.Lock()
+	defer l.scopes.mu.Unlock()
+	names := make([]string, 0, len(l.scopes.levels))
+	for name := range l.scopes.levels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseLevel returns the telemetry.Level for the provided level name. Level
+// names are case insensitive and, as telemetry has no warning level, warn and
+// warning map to info.
+func ParseLevel(level string) (telemetry.Level, error) {
+	l := strings.ToLower(strings.TrimSpace(level))
+	if l == "warn" || l == "warning" {
+		// telemetry has no warning level, closest match is info
+		l = "info"
+	}
+	lvl, ok := telemetry.FromLevel(l)
+	if !ok {
+		return lvl, fmt.Errorf("%q (supported: none, error, warn, info, debug)", level)
+	}
+	return lvl, nil
+}
+
+// ParseScopeLevels returns the levels per scope name for the provided
+// scope:level pairs, parsing the levels with ParseLevel.
+func ParseScopeLevels(pairs []string) (map[string]telemetry.Level, error) {
+	levels := make(map[string]telemetry.Level, len(pairs))
+	for _, pair := range pairs {
+		idx := strings.LastIndex(pair, ":")
+		if idx < 1 {
+			return nil, fmt.Errorf("%q (expected scope:level)", pair)
+		}
+		name := strings.TrimSpace(pair[:idx])
+		lvl, err := ParseLevel(pair[idx+1:])
+		if err != nil {
+			return nil, fmt.Errorf("scope %q: %w", name, err)
+		}
+		levels[name] = lvl
+	}
+	return levels, nil
+}
@@ -0,0 +1,165 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logconfig implements a run.Group Unit setting up the Group Logger
+// from flags.
+package logconfig
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/tetratelabs/telemetry"
+
+	"github.com/tetratelabs/run"
+	"github.com/tetratelabs/run/pkg/log"
+)
+
+// Config is a run.Group Config and Initializer Unit building a pkg/log Logger
+// configured through the --log-level, --log-format, --log-output and
+// --log-scopes flags. As a run.LoggerProvider, its Logger is used as the Group
+// Logger for all phases, with the flags applied in the Config phase before
+// PreRun starts.
+type Config struct {
+	// Level holds the default log level, info if empty.
+	Level string
+	// Format holds the default log format, text if empty.
+	Format string
+	// Output holds the default log destination: stderr, stdout or a file
+	// path. Defaults to stderr if empty.
+	Output string
+	// Scopes holds the default log levels per scope, formatted as
+	// scope:level pairs.
+	Scopes []string
+
+	logger *log.Logger
+	file   *log.File
+}
+
+// Name implements run.Unit.
+func (c *Config) Name() string {
+	return "log-config"
+}
+
+// Initialize implements run.Initializer.
+func (c *Config) Initialize() {
+	if c.logger == nil {
+		c.logger = log.New()
+	}
+}
+
+// Logger implements run.LoggerProvider.
+func (c *Config) Logger() telemetry.Logger {
+	c.Initialize()
+	return c.logger
+}
+
+// FlagSet implements run.Config.
+func (c *Config) FlagSet() *run.FlagSet {
+	if c.Level == "" {
+		c.Level = telemetry.LevelInfo.String()
+	}
+	if c.Format == "" {
+		c.Format = string(log.FormatText)
+	}
+	if c.Output == "" {
+		c.Output = "stderr"
+	}
+	fs := run.NewFlagSet("Logging options")
+	fs.StringVar(&c.Level, "log-level", c.Level,
+		"log level: none, error, info or debug.")
+	fs.StringVar(&c.Format, "log-format", c.Format,
+		"log format: text, logfmt or json.")
+	fs.StringVar(&c.Output, "log-output", c.Output,
+		"log destination: stderr, stdout or a file path.")
+	fs.StringSliceVar(&c.Scopes, "log-scopes", c.Scopes,
+		"log level per scope (Unit name), e.g. xds:debug,db:warn.")
+	return fs
+}
+
+// Validate implements run.Config, applying the flag values to the Logger if
+// all of them are valid.
+func (c *Config) Validate() error {
+	level, err := log.ParseLevel(c.Level)
+	if err != nil {
+		return fmt.Errorf("%w: %v", run.ErrInvalidLogLevel, err)
+	}
+	format, ok := log.FromFormat(strings.ToLower(c.Format))
+	if !ok {
+		return fmt.Errorf("%w: %q (supported: text, logfmt, json)",
+			run.ErrInvalidLogFormat, c.Format)
+	}
+	scopes, err := log.ParseScopeLevels(c.Scopes)
+	if err != nil {
+		return fmt.Errorf("%w: %v", run.ErrInvalidLogLevel, err)
+	}
+	out, file, err := c.output()
+	if err != nil {
+		return err
+	}
+
+	c.Initialize()
+	c.logger.SetLevel(level)
+	c.logger.SetFormat(format)
+	c.logger.SetOutput(out)
+	for name, lvl := range scopes {
+		c.logger.SetScopeLevel(name, lvl)
+	}
+	if c.file != nil && c.file != file {
+		_ = c.file.Close()
+	}
+	c.file = file
+	return nil
+}
+
+// Close implements io.Closer, flushing and closing the log file if logging to
+// one. The Logger writes to stderr afterwards.
+func (c *Config) Close() error {
+	if c.file == nil {
+		return nil
+	}
+	c.logger.SetOutput(nil)
+	err := c.file.Close()
+	c.file = nil
+	return err
+}
+
+// output returns the writer for the requested log destination, reusing an
+// already opened log file for the same path. A nil writer directs log lines
+// to the standard library logger, which writes to stderr.
+func (c *Config) output() (io.Writer, *log.File, error) {
+	switch c.Output {
+	case "stderr":
+		return nil, nil, nil
+	case "stdout":
+		return os.Stdout, nil, nil
+	}
+	if c.file != nil && c.file.Config().Path == c.Output {
+		return c.file, c.file, nil
+	}
+	f, err := log.OpenFile(log.FileConfig{Path: c.Output})
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f, nil
+}
+
+var (
+	_ run.Config         = (*Config)(nil)
+	_ run.Initializer    = (*Config)(nil)
+	_ run.LoggerProvider = (*Config)(nil)
+	_ io.Closer          = (*Config)(nil)
+)
@@ -0,0 +1,111 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logconfig_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tetratelabs/telemetry"
+
+	"github.com/tetratelabs/run"
+	"github.com/tetratelabs/run/pkg/logconfig"
+)
+
+type scopedUnit struct {
+	name   string
+	logger telemetry.Logger
+}
+
+func (s *scopedUnit) Name() string                 { return s.name }
+func (s *scopedUnit) SetLogger(l telemetry.Logger) { s.logger = l }
+func (s *scopedUnit) PreRun() error {
+	s.logger.Debug("pre-run debug")
+	s.logger.Info("pre-run info")
+	return nil
+}
+
+func TestConfig(t *testing.T) {
+	var (
+		path = filepath.Join(t.TempDir(), "test.log")
+		cfg  = &logconfig.Config{}
+		xds  = &scopedUnit{name: "xds"}
+		db   = &scopedUnit{name: "db"}
+		g    = run.Group{Name: "test"}
+	)
+	g.Register(cfg, xds, db)
+
+	err := g.Run("--log-level", "debug", "--log-format", "logfmt",
+		"--log-output", path, "--log-scopes", "db:error")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if g.Logger != cfg.Logger() {
+		t.Errorf("expected the Group to use the Config Logger")
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := string(b)
+	for _, want := range []string{
+		`msg="pre-run debug" scope=xds`,
+		`msg="pre-run info" scope=xds`,
+		`msg=done`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in %q", want, out)
+		}
+	}
+	if strings.Contains(out, "scope=db") {
+		t.Errorf("expected db scope to log errors only: %q", out)
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	for _, tt := range []struct {
+		args []string
+		err  error
+	}{
+		{[]string{"--log-level", "trace"}, run.ErrInvalidLogLevel},
+		{[]string{"--log-scopes", "xds"}, run.ErrInvalidLogLevel},
+		{[]string{"--log-scopes", "xds:loud"}, run.ErrInvalidLogLevel},
+		{[]string{"--log-format", "xml"}, run.ErrInvalidLogFormat},
+	} {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			g := run.Group{Name: "test"}
+			g.Register(&logconfig.Config{})
+			err := g.RunConfig(tt.args...)
+			if err == nil || !strings.Contains(err.Error(), tt.err.Error()) {
+				t.Errorf("expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+
+	// the Group does not register its own log flags next to a LoggerProvider
+	g := run.Group{Name: "test"}
+	g.Register(&logconfig.Config{})
+	if err := g.RunConfig("--log-file", "test.log"); err == nil {
+		t.Errorf("expected unknown flag error")
+	}
+
+	g = run.Group{Name: "test"}
+	g.Register(&logconfig.Config{})
+	if err := g.RunConfig("--log-level", "WARN"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,332 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics implements an in-process telemetry.MetricSink, exposing
+// its metrics in the Prometheus text format through a run.Group Service.
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/tetratelabs/telemetry"
+)
+
+// Default holds the Registry used by a Service without an explicit Registry.
+// To bootstrap metrics of libraries using the global telemetry MetricSink,
+// call telemetry.SetGlobalMetricSink(metrics.Default).
+var Default = NewRegistry()
+
+// kind holds the aggregation type of a metric family.
+type kind int
+
+const (
+	kindSum kind = iota
+	kindGauge
+	kindDistribution
+)
+
+func (k kind) String() string {
+	switch k {
+	case kindSum:
+		return "counter"
+	case kindGauge:
+		return "gauge"
+	}
+	return "histogram"
+}
+
+// Registry holds the metrics created through its telemetry.MetricSink
+// methods. Sums are exposed as Prometheus counters, Gauges as gauges and
+// Distributions as histograms. As Prometheus counters can only go up, negative
+// values recorded on Sums, e.g. through Decrement, are ignored. Use a Gauge
+// for values that can go down. Creating a metric with the name of an existing
+// metric of the same type returns the existing one. Registry is safe for
+// concurrent use.
+type Registry struct {
+	mu       sync.RWMutex
+	families map[string]*family
+}
+
+// NewRegistry returns a new, empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// NewSum implements telemetry.MetricSink.
+func (r *Registry) NewSum(name, description string, opts ...telemetry.MetricOption) telemetry.Metric {
+	return r.register(kindSum, name, description, nil, opts)
+}
+
+// NewGauge implements telemetry.MetricSink.
+func (r *Registry) NewGauge(name, description string, opts ...telemetry.MetricOption) telemetry.Metric {
+	return r.register(kindGauge, name, description, nil, opts)
+}
+
+// NewDistribution implements telemetry.MetricSink.
+func (r *Registry) NewDistribution(name, description string, bounds []float64, opts ...telemetry.MetricOption) telemetry.Metric {
+	b := append([]float64(nil), bounds...)
+	sort.Float64s(b)
+	return r.register(kindDistribution, name, description, b, opts)
+}
+
+// NewLabel implements telemetry.MetricSink. Characters not allowed in
+// Prometheus label names are replaced by underscores.
+func (r *Registry) NewLabel(name string) telemetry.Label {
+	return label(sanitize(name, false))
+}
+
+// ContextWithLabels implements telemetry.MetricSink. It returns an error if
+// the provided values were not created by a Label of this package.
+func (r *Registry) ContextWithLabels(ctx context.Context, values ...telemetry.LabelValue) (context.Context, error) {
+	for _, v := range values {
+		if _, ok := v.(labelOp); !ok {
+			return ctx, fmt.Errorf("metrics: unsupported label value %T", v)
+		}
+	}
+	existing, _ := ctx.Value(labelsKey{}).([]telemetry.LabelValue)
+	merged := make([]telemetry.LabelValue, 0, len(existing)+len(values))
+	merged = append(merged, existing...)
+	return context.WithValue(ctx, labelsKey{}, append(merged, values...)), nil
+}
+
+func (r *Registry) register(k kind, name, description string, bounds []float64, opts []telemetry.MetricOption) telemetry.Metric {
+	var o telemetry.MetricOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	name = sanitize(name, true)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.families[name]; ok {
+		if f.kind != k {
+			panic(fmt.Sprintf("metrics: %s already registered as %s", name, f.kind))
+		}
+		return &metric{f: f}
+	}
+	f := &family{
+		name:   name,
+		help:   description,
+		kind:   k,
+		bounds: bounds,
+		series: make(map[string]*series),
+	}
+	for _, l := range o.Labels {
+		f.labels = append(f.labels, labelName(l))
+	}
+	if len(f.labels) == 0 {
+		// expose metrics without dimensions before their first observation
+		f.get(nil)
+	}
+	r.families[name] = f
+	return &metric{f: f}
+}
+
+// family holds all series of a metric.
+type family struct {
+	name   string
+	help   string
+	kind   kind
+	labels []string
+	bounds []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+// series holds the observations of a metric for a single set of label values.
+type series struct {
+	labelValues []string
+	value       float64
+	buckets     []uint64
+	sum         float64
+	count       uint64
+}
+
+// get returns the series for the provided label values. The mutex must be
+// held, or the family not yet be shared.
+func (f *family) get(labelValues []string) *series {
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: labelValues}
+		if f.kind == kindDistribution {
+			s.buckets = make([]uint64, len(f.bounds))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (f *family) observe(labels map[string]string, value float64) {
+	labelValues := make([]string, len(f.labels))
+	for idx, name := range f.labels {
+		labelValues[idx] = labels[name]
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := f.get(labelValues)
+	switch f.kind {
+	case kindSum:
+		if value < 0 {
+			// a decreasing counter is seen as a counter reset
+			return
+		}
+		s.value += value
+	case kindGauge:
+		s.value = value
+	case kindDistribution:
+		for idx, bound := range f.bounds {
+			if value <= bound {
+				s.buckets[idx]++
+			}
+		}
+		s.sum += value
+		s.count++
+	}
+}
+
+// metric implements telemetry.Metric.
+type metric struct {
+	f      *family
+	values []telemetry.LabelValue
+}
+
+func (m *metric) Increment() {
+	m.Record(1)
+}
+
+func (m *metric) Decrement() {
+	m.Record(-1)
+}
+
+func (m *metric) Name() string {
+	return m.f.name
+}
+
+func (m *metric) Record(value float64) {
+	m.RecordContext(context.Background(), value)
+}
+
+func (m *metric) RecordContext(ctx context.Context, value float64) {
+	labels := make(map[string]string)
+	if values, ok := ctx.Value(labelsKey{}).([]telemetry.LabelValue); ok {
+		applyLabels(labels, values)
+	}
+	applyLabels(labels, m.values)
+	m.f.observe(labels, value)
+}
+
+func (m *metric) With(labelValues ...telemetry.LabelValue) telemetry.Metric {
+	values := make([]telemetry.LabelValue, 0, len(m.values)+len(labelValues))
+	values = append(values, m.values...)
+	return &metric{f: m.f, values: append(values, labelValues...)}
+}
+
+// labelsKey is the context key holding label values.
+type labelsKey struct{}
+
+// opKind holds the operation a labelOp applies.
+type opKind int
+
+const (
+	opInsert opKind = iota
+	opUpdate
+	opUpsert
+	opDelete
+)
+
+// label implements telemetry.Label.
+type label string
+
+// labelOp implements telemetry.LabelValue.
+type labelOp struct {
+	name  string
+	op    opKind
+	value string
+}
+
+func (l label) Insert(value string) telemetry.LabelValue {
+	return labelOp{name: string(l), op: opInsert, value: value}
+}
+
+func (l label) Update(value string) telemetry.LabelValue {
+	return labelOp{name: string(l), op: opUpdate, value: value}
+}
+
+func (l label) Upsert(value string) telemetry.LabelValue {
+	return labelOp{name: string(l), op: opUpsert, value: value}
+}
+
+func (l label) Delete() telemetry.LabelValue {
+	return labelOp{name: string(l), op: opDelete}
+}
+
+// labelName returns the name of a Label. Labels of other MetricSink
+// implementations are named by their string representation.
+func labelName(l telemetry.Label) string {
+	if n, ok := l.(label); ok {
+		return string(n)
+	}
+	return sanitize(fmt.Sprint(l), false)
+}
+
+// applyLabels applies the label operations in sequence.
+func applyLabels(labels map[string]string, values []telemetry.LabelValue) {
+	for _, v := range values {
+		op, ok := v.(labelOp)
+		if !ok {
+			continue
+		}
+		_, set := labels[op.name]
+		switch {
+		case op.op == opDelete:
+			delete(labels, op.name)
+		case op.op == opUpsert,
+			op.op == opInsert && !set,
+			op.op == opUpdate && set:
+			labels[op.name] = op.value
+		}
+	}
+}
+
+// sanitize replaces the characters not allowed in Prometheus metric names
+// (allowing colons) or label names with underscores.
+func sanitize(name string, colons bool) string {
+	if name == "" {
+		return "_"
+	}
+	b := []byte(name)
+	for idx, c := range b {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && idx > 0:
+		case c == ':' && colons:
+		default:
+			b[idx] = '_'
+		}
+	}
+	return string(b)
+}
+
+var (
+	_ telemetry.MetricSink = (*Registry)(nil)
+	_ telemetry.Metric     = (*metric)(nil)
+	_ telemetry.Label      = label("")
+)
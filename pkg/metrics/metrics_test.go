@@ -0,0 +1,162 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+
+	"github.com/tetratelabs/run"
+	"github.com/tetratelabs/run/pkg/metrics"
+	"github.com/tetratelabs/run/pkg/test"
+)
+
+func TestRegistry(t *testing.T) {
+	var (
+		r      = metrics.NewRegistry()
+		method = r.NewLabel("method")
+		code   = r.NewLabel("code")
+	)
+	requests := r.NewSum("http.requests", "Handled HTTP requests.",
+		telemetry.WithLabels(method, code))
+	inflight := r.NewGauge("http_inflight", "In-flight HTTP requests.")
+	latency := r.NewDistribution("http_latency_seconds", "HTTP latency.",
+		[]float64{0.5, 0.1}, telemetry.WithUnit(telemetry.Seconds))
+	_ = r.NewSum("unused_total", "Line one\nline \\two.")
+
+	if want, have := "http_requests", requests.Name(); want != have {
+		t.Errorf("want name %q, have %q", want, have)
+	}
+
+	get := requests.With(method.Insert("GET"))
+	get.With(code.Insert("200")).Increment()
+	get.With(code.Insert("200")).Record(2)
+	// counters can't go down
+	get.With(code.Insert("200")).Decrement()
+	// insert does not overwrite, upsert does
+	get.With(method.Insert("POST"), code.Upsert("500")).Increment()
+	ctx, err := r.ContextWithLabels(context.Background(), method.Insert("PUT"), code.Insert("204"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	requests.With(code.Update(`a"b`)).RecordContext(ctx, 1)
+	requests.With(code.Delete()).RecordContext(ctx, 1)
+	if _, err = r.ContextWithLabels(ctx, "invalid"); err == nil {
+		t.Errorf("expected unsupported label value error")
+	}
+
+	inflight.Increment()
+	inflight.Record(3)
+	latency.Record(0.05)
+	latency.Record(0.3)
+	latency.Record(2)
+
+	// registering again returns the existing metric
+	r.NewGauge("http_inflight", "").Increment()
+
+	var buf bytes.Buffer
+	if err = r.WritePrometheus(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `# HELP http_inflight In-flight HTTP requests.
+# TYPE http_inflight gauge
+http_inflight 1
+# HELP http_latency_seconds HTTP latency.
+# TYPE http_latency_seconds histogram
+http_latency_seconds_bucket{le="0.1"} 1
+http_latency_seconds_bucket{le="0.5"} 2
+http_latency_seconds_bucket{le="+Inf"} 3
+http_latency_seconds_sum 2.35
+http_latency_seconds_count 3
+# HELP http_requests Handled HTTP requests.
+# TYPE http_requests counter
+http_requests{method="GET",code="200"} 3
+http_requests{method="GET",code="500"} 1
+http_requests{method="PUT"} 1
+http_requests{method="PUT",code="a\"b"} 1
+# HELP unused_total Line one\nline \\two.
+# TYPE unused_total counter
+unused_total 0
+`
+	if have := buf.String(); want != have {
+		t.Errorf("unexpected exposition:\nwant:\n%s\nhave:\n%s", want, have)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic on type conflict")
+		}
+	}()
+	r.NewSum("http_inflight", "")
+}
+
+func TestService(t *testing.T) {
+	var (
+		r   = metrics.NewRegistry()
+		svc = &metrics.Service{Registry: r}
+		irq = test.NewIRQService(func() {})
+		g   = run.Group{Logger: telemetry.NoopLogger()}
+	)
+	r.NewSum("requests_total", "").Increment()
+	g.Register(svc, irq)
+
+	errs := make(chan error)
+	go func() {
+		errs <- g.Run("./metrics", "--metrics-listen-addr", "127.0.0.1:0")
+	}()
+	defer func() {
+		_ = irq.Close()
+		if err := <-errs; err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}()
+
+	var (
+		res *http.Response
+		err error
+	)
+	for i := 0; i < 100; i++ {
+		if addr := svc.Addr(); addr != nil {
+			if res, err = http.Get("http://" + addr.String() + metrics.Path); err == nil {
+				break
+			}
+		}
+		<-time.After(10 * time.Millisecond)
+	}
+	if res == nil {
+		t.Fatalf("metrics endpoint not reachable: %v", err)
+	}
+	b, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if want, have := metrics.ContentType, res.Header.Get("Content-Type"); want != have {
+		t.Errorf("want content type %q, have %q", want, have)
+	}
+	if want := "requests_total 1\n"; !strings.Contains(string(b), want) {
+		t.Errorf("expected %q in %q", want, b)
+	}
+
+	g2 := run.Group{Logger: telemetry.NoopLogger()}
+	g2.Register(&metrics.Service{})
+	if err = g2.RunConfig("--metrics-listen-addr", "localhost"); err == nil {
+		t.Errorf("expected invalid listen address error")
+	}
+}
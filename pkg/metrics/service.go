@@ -0,0 +1,125 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/run"
+)
+
+// Path holds the HTTP path the Service exposes the metrics on.
+const Path = "/metrics"
+
+// DefaultListenAddr holds the default listen address of the Service.
+const DefaultListenAddr = ":9090"
+
+// shutdownTimeout holds the time in-flight scrapes get to finish on shutdown.
+const shutdownTimeout = 5 * time.Second
+
+// Service implements a run.Group Service exposing the metrics of a Registry
+// in the Prometheus text format on /metrics. Its listen address is
+// configurable through the --metrics-listen-addr flag.
+type Service struct {
+	// Registry holds the metrics to expose. If nil, Default is used.
+	Registry *Registry
+	// ListenAddr holds the default listen address, DefaultListenAddr if
+	// empty.
+	ListenAddr string
+
+	mu  sync.Mutex
+	l   net.Listener
+	srv *http.Server
+}
+
+// Name implements run.Unit.
+func (s *Service) Name() string {
+	return "metrics"
+}
+
+// FlagSet implements run.Config.
+func (s *Service) FlagSet() *run.FlagSet {
+	if s.ListenAddr == "" {
+		s.ListenAddr = DefaultListenAddr
+	}
+	fs := run.NewFlagSet("Metrics options")
+	fs.StringVar(&s.ListenAddr, "metrics-listen-addr", s.ListenAddr,
+		"address to expose Prometheus metrics on")
+	return fs
+}
+
+// Validate implements run.Config.
+func (s *Service) Validate() error {
+	if _, _, err := net.SplitHostPort(s.ListenAddr); err != nil {
+		return fmt.Errorf("invalid metrics listen address %q: %w", s.ListenAddr, err)
+	}
+	return nil
+}
+
+// PreRun implements run.PreRunner, binding the listen address.
+func (s *Service) PreRun() error {
+	if s.Registry == nil {
+		s.Registry = Default
+	}
+	l, err := net.Listen("tcp", s.ListenAddr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle(Path, s.Registry.Handler())
+	s.mu.Lock()
+	s.l = l
+	s.srv = &http.Server{Handler: mux, ReadHeaderTimeout: shutdownTimeout}
+	s.mu.Unlock()
+	return nil
+}
+
+// Serve implements run.Service.
+func (s *Service) Serve() error {
+	if err := s.srv.Serve(s.l); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// GracefulStop implements run.Service.
+func (s *Service) GracefulStop() {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	_ = s.srv.Shutdown(ctx)
+}
+
+// Addr returns the address the Service listens on, which is useful when
+// listening on port 0. It returns nil before the PreRun phase.
+func (s *Service) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.l == nil {
+		return nil
+	}
+	return s.l.Addr()
+}
+
+var (
+	_ run.Config    = (*Service)(nil)
+	_ run.PreRunner = (*Service)(nil)
+	_ run.Service   = (*Service)(nil)
+)
@@ -0,0 +1,101 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signal
+
+import (
+	"os"
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+)
+
+// levelForcer is implemented by Loggers able to temporarily force a level on
+// themselves and all their scopes, like the pkg/log Logger.
+type levelForcer interface {
+	ForceLevel(level telemetry.Level)
+	ClearForcedLevel()
+}
+
+// debugToggle holds the state of a debug level enabled through ToggleDebug.
+type debugToggle struct {
+	enabled  bool
+	previous telemetry.Level
+	timer    *time.Timer
+}
+
+// ToggleDebug is a HandlerFunc toggling the Group Logger between its
+// configured level and debug. If DebugTimeout is set, the debug level is
+// reverted automatically after the timeout. Each toggle is logged at info
+// level.
+//
+// If the Logger supports it, like the pkg/log Logger, the debug level is
+// forced on all its scopes and reverting restores the configured levels of
+// the Logger and its scopes. Otherwise SetLevel is used, so for scoped
+// Loggers only the level of the scope is toggled.
+func (h *Handler) ToggleDebug(sig os.Signal) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.debug.enabled {
+		h.disableDebug("signal", sig)
+		return nil
+	}
+
+	l := h.log()
+	if f, ok := l.(levelForcer); ok {
+		f.ForceLevel(telemetry.LevelDebug)
+	} else {
+		h.debug.previous = l.Level()
+		l.SetLevel(telemetry.LevelDebug)
+	}
+	h.debug.enabled = true
+	if h.DebugTimeout > 0 {
+		h.debug.timer = time.AfterFunc(h.DebugTimeout, func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			if h.debug.enabled {
+				h.disableDebug("reason", "timeout")
+			}
+		})
+		l.Info("debug logging enabled", "signal", sig, "revert_after", h.DebugTimeout)
+		return nil
+	}
+	l.Info("debug logging enabled", "signal", sig)
+	return nil
+}
+
+// disableDebug reverts the debug level, logging the reason before doing so to
+// have it show up at the configured level. The mutex must be held.
+func (h *Handler) disableDebug(keyValuePairs ...interface{}) {
+	l := h.log()
+	l.Info("debug logging disabled", keyValuePairs...)
+	if f, ok := l.(levelForcer); ok {
+		f.ClearForcedLevel()
+	} else {
+		l.SetLevel(h.debug.previous)
+	}
+	if h.debug.timer != nil {
+		h.debug.timer.Stop()
+		h.debug.timer = nil
+	}
+	h.debug.enabled = false
+}
+
+// log returns the Logger of the Handler. The mutex must be held.
+func (h *Handler) log() telemetry.Logger {
+	if h.logger == nil {
+		return telemetry.NoopLogger()
+	}
+	return h.logger
+}
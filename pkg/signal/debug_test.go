@@ -0,0 +1,103 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+
+	"github.com/tetratelabs/run/pkg/log"
+)
+
+func TestSignalHandlerToggleDebug(t *testing.T) {
+	var (
+		buf    lockedBuffer
+		logger = log.New()
+		scope  = logger.Scope("xds")
+		s      = Handler{DebugOnUSR1: true}
+	)
+	if debugSignal == nil {
+		t.Skip("debug signal not supported on this platform")
+	}
+	logger.SetOutput(&buf)
+	logger.SetFormat(log.FormatLogfmt)
+	s.SetLogger(logger)
+
+	if err := s.PreRun(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := s.handlers[debugSignal]; !ok {
+		t.Fatal("expected a SIGUSR1 handler")
+	}
+
+	if err := s.handlers[debugSignal](debugSignal); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want, have := telemetry.LevelDebug, scope.Level(); want != have {
+		t.Errorf("scope level: want %v, have %v", want, have)
+	}
+	if err := s.handlers[debugSignal](debugSignal); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want, have := telemetry.LevelInfo, scope.Level(); want != have {
+		t.Errorf("scope level: want %v, have %v", want, have)
+	}
+	for _, want := range []string{
+		`msg="debug logging enabled" signal="` + debugSignal.String() + `"`,
+		`msg="debug logging disabled" signal="` + debugSignal.String() + `"`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected %q in %q", want, buf.String())
+		}
+	}
+}
+
+func TestSignalHandlerToggleDebugTimeout(t *testing.T) {
+	var (
+		buf    lockedBuffer
+		logger = log.New()
+		s      = Handler{DebugTimeout: 20 * time.Millisecond}
+	)
+	if debugSignal == nil {
+		t.Skip("debug signal not supported on this platform")
+	}
+	logger.SetOutput(&buf)
+	logger.SetFormat(log.FormatLogfmt)
+	s.SetLogger(logger)
+
+	if err := s.ToggleDebug(debugSignal); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want, have := telemetry.LevelDebug, logger.Level(); want != have {
+		t.Errorf("level: want %v, have %v", want, have)
+	}
+	if !strings.Contains(buf.String(), "revert_after=20ms") {
+		t.Errorf("expected revert_after in %q", buf.String())
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for logger.Level() != telemetry.LevelInfo && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if want, have := telemetry.LevelInfo, logger.Level(); want != have {
+		t.Errorf("reverted level: want %v, have %v", want, have)
+	}
+	if want := `msg="debug logging disabled" reason=timeout`; !strings.Contains(buf.String(), want) {
+		t.Errorf("expected %q in %q", want, buf.String())
+	}
+}
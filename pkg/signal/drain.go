@@ -0,0 +1,52 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signal
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// drain notifies the Drainer Units of the Group and waits for DrainDelay to
+// pass, a second termination signal or the Group to shut down. It keeps
+// handling other signals in the meantime and returns the termination signals
+// received so far.
+func (h *Handler) drain(ctx context.Context, sig os.Signal, received []time.Time) []time.Time {
+	h.mu.Lock()
+	status, logger := h.status, h.log()
+	h.mu.Unlock()
+
+	logger.Info("draining", "signal", sig, "delay", h.DrainDelay)
+	if status != nil {
+		status.Drain()
+	}
+
+	t := time.NewTimer(h.DrainDelay)
+	defer t.Stop()
+	for {
+		select {
+		case sig := <-h.signal:
+			if handle(h.handlers, sig) != nil {
+				logger.Info("drain cut short", "signal", sig)
+				return append(received, time.Now())
+			}
+		case <-t.C:
+			return received
+		case <-ctx.Done():
+			return received
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signal
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+
+	"github.com/tetratelabs/run"
+	"github.com/tetratelabs/run/pkg/test"
+)
+
+type drainer chan struct{}
+
+func (d drainer) Name() string { return "drainer" }
+func (d drainer) Drain()       { close(d) }
+
+func TestSignalHandlerDrain(t *testing.T) {
+	tests := []struct {
+		name     string
+		signals  []os.Signal
+		duration time.Duration
+	}{
+		{name: "delay", signals: []os.Signal{syscall.SIGTERM}, duration: 200 * time.Millisecond},
+		{name: "cut short", signals: []os.Signal{syscall.SIGTERM, syscall.SIGINT}},
+		{name: "other signals", signals: []os.Signal{syscall.SIGTERM, syscall.SIGHUP}, duration: 200 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				g     = run.Group{Logger: telemetry.NoopLogger()}
+				d     = make(drainer)
+				s     = Handler{DrainDelay: 200 * time.Millisecond, exit: func(int) {}}
+				ready = make(chan struct{})
+				res   = make(chan error)
+				stop  = make(chan struct{})
+			)
+			g.Register(&s, preRunner(func() error { close(ready); return nil }), d, &test.TestSvc{
+				SvcName:   "svc",
+				Execute:   func() error { <-stop; return nil },
+				Interrupt: func() { close(stop) },
+			})
+
+			go func() { res <- g.Run() }()
+			<-ready
+			time.Sleep(5 * time.Millisecond)
+			start := time.Now()
+			for _, sig := range tt.signals {
+				s.send(sig)
+				time.Sleep(5 * time.Millisecond)
+			}
+
+			select {
+			case <-d:
+			case <-time.After(50 * time.Millisecond):
+				t.Fatal("expected Drainer to be notified")
+			}
+			if err := <-res; err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			elapsed := time.Since(start)
+			if tt.duration > 0 && elapsed < tt.duration {
+				t.Errorf("expected shutdown after %v drain, got %v", tt.duration, elapsed)
+			}
+			if tt.duration == 0 && elapsed >= s.DrainDelay {
+				t.Errorf("expected drain to be cut short, got %v", elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+
+	"github.com/tetratelabs/run"
+)
+
+// Dump is a HandlerFunc writing a diagnostic dump holding the state of the
+// Group's Units and the stacks of all goroutines to DumpPath, or stderr if
+// not set. The process keeps running. Unit states are only available if the
+// Handler is registered with a run.Group.
+func (h *Handler) Dump(sig os.Signal) error {
+	h.mu.Lock()
+	status, logger, path, w := h.status, h.logger, h.DumpPath, h.stderr
+	h.mu.Unlock()
+	if logger == nil {
+		logger = telemetry.NoopLogger()
+	}
+	if w == nil {
+		w = os.Stderr
+	}
+
+	if path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			// a failing dump should not bring down the process
+			logger.Error("diagnostic dump", err, "signal", sig, "path", path)
+			return nil
+		}
+		defer func() { _ = f.Close() }()
+		w = f
+	}
+	if err := writeDump(w, sig, status); err != nil {
+		logger.Error("diagnostic dump", err, "signal", sig, "path", path)
+		return nil
+	}
+	logger.Info("diagnostic dump written", "signal", sig, "path", path)
+	return nil
+}
+
+// writeDump writes the diagnostic dump to w in a single write.
+func writeDump(w io.Writer, sig os.Signal, status *run.Status) error {
+	now := time.Now()
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "=== diagnostic dump on %s at %s ===\n\n", sig, now.Format(time.RFC3339Nano))
+
+	buf.WriteString("units:\n")
+	switch units := statusUnits(status); {
+	case status == nil:
+		buf.WriteString("  unknown: not registered with a run.Group\n")
+	case len(units) == 0:
+		buf.WriteString("  none serving\n")
+	default:
+		tw := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+		for _, u := range units {
+			fmt.Fprintf(tw, "  %s\t%s\tfor %s\n", u.Name, u.State, now.Sub(u.Since).Round(time.Millisecond))
+		}
+		_ = tw.Flush()
+	}
+
+	fmt.Fprintf(&buf, "\ngoroutines (%d):\n", runtime.NumGoroutine())
+	buf.Write(stacks())
+	buf.WriteString("\n=== end of diagnostic dump ===\n")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func statusUnits(status *run.Status) []run.UnitStatus {
+	if status == nil {
+		return nil
+	}
+	return status.Units()
+}
+
+// stacks returns the stacks of all goroutines.
+func stacks() []byte {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signal
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+
+	"github.com/tetratelabs/run"
+	"github.com/tetratelabs/run/pkg/test"
+)
+
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestSignalHandlerDump(t *testing.T) {
+	var (
+		stderr lockedBuffer
+		path   = filepath.Join(t.TempDir(), "dump.txt")
+		wantRE = regexp.MustCompile(`(?s)^=== diagnostic dump on quit at \S+ ===\n\n` +
+			`units:\n  irqsvc\s+serving\s+for \S+\n  signal\s+serving\s+for \S+\n\n` +
+			`goroutines \(\d+\):\ngoroutine \d+ \[running\]:\n.*TestSignalHandlerDump.*` +
+			`\n=== end of diagnostic dump ===\n$`)
+	)
+
+	for _, dumpPath := range []string{"", path} {
+		var (
+			g   = run.Group{Logger: telemetry.NoopLogger()}
+			irq = test.NewIRQService(func() {})
+			s   = Handler{DumpOnQuit: true, DumpPath: dumpPath, stderr: &stderr}
+		)
+		ready := make(chan struct{})
+		g.Register(&s, preRunner(func() error { close(ready); return nil }), irq)
+
+		res := make(chan error)
+		go func() { res <- g.Run() }()
+		<-ready
+		time.Sleep(10 * time.Millisecond)
+		s.send(syscall.SIGQUIT)
+
+		select {
+		case err := <-res:
+			t.Fatalf("expected the Group to keep running, got %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+		_ = irq.Close()
+		if err := <-res; err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+
+	if !wantRE.MatchString(stderr.String()) {
+		t.Errorf("unexpected dump on stderr:\n%s", stderr.String())
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !wantRE.Match(b) {
+		t.Errorf("unexpected dump in file:\n%s", b)
+	}
+}
+
+func TestDumpWithoutGroup(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		s   = Handler{stderr: &buf}
+	)
+	if err := s.Dump(syscall.SIGQUIT); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "units:\n  unknown: not registered with a run.Group\n"; !bytes.Contains(buf.Bytes(), []byte(want)) {
+		t.Errorf("expected %q in %q", want, buf.String())
+	}
+}
@@ -17,10 +17,17 @@ package signal
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
+
+	"github.com/tetratelabs/telemetry"
 
 	"github.com/tetratelabs/run"
 )
@@ -31,23 +38,108 @@ type Error string
 // Error implements error.
 func (e Error) Error() string { return string(e) }
 
-// Handler implements a unix signal handler as run.GroupService.
+// HandlerFunc handles a received signal. If it returns nil, the Handler keeps
+// listening for signals. To request a clean shutdown, return an error wrapping
+// run.ErrRequestedShutdown, like Shutdown does. Any other error stops the
+// Handler in error, which in a run.Group environment fails the entire
+// run.Group.
+type HandlerFunc func(sig os.Signal) error
+
+// Shutdown is a HandlerFunc requesting a clean shutdown.
+func Shutdown(sig os.Signal) error {
+	return fmt.Errorf("%s %w", sig, run.ErrRequestedShutdown)
+}
+
+// Ignore is a HandlerFunc ignoring the signal.
+func Ignore(os.Signal) error {
+	return nil
+}
+
+// Handler implements a unix signal handler as run.GroupService. All of its
+// methods, including Name, have pointer receivers: register a *Handler with
+// run.Group and don't copy a Handler after first use.
 type Handler struct {
 	// RefreshCallback is called when a syscall.SIGHUP is received.
 	// If the callback returns an error, the signal handler is stopped. In a
 	// run.Group environment this means the entire run.Group is requested to
 	// stop.
+	// RefreshCallback is only used if Signals is nil.
 	RefreshCallback func() error
 
-	signal chan os.Signal
-	cancel chan struct{}
+	// Signals holds the signals to listen for and their HandlerFunc. A nil
+	// HandlerFunc ignores the signal. If Signals is nil, the Handler listens
+	// for syscall.SIGHUP, calling RefreshCallback, and requests shutdown on
+	// syscall.SIGINT, syscall.SIGQUIT and syscall.SIGTERM.
+	Signals map[os.Signal]HandlerFunc
+
+	// DumpOnQuit makes the default syscall.SIGQUIT handling write a
+	// diagnostic dump, using Dump, instead of requesting shutdown. Only used
+	// if Signals is nil.
+	DumpOnQuit bool
+	// DumpPath holds the file diagnostic dumps are appended to. If empty,
+	// dumps are written to stderr.
+	DumpPath string
+
+	// DebugOnUSR1 makes the Handler toggle the Group Logger between its
+	// configured level and debug on syscall.SIGUSR1, using ToggleDebug. Only
+	// used if Signals is nil and on platforms providing SIGUSR1.
+	DebugOnUSR1 bool
+	// DebugTimeout holds the duration after which a debug level enabled
+	// through ToggleDebug is reverted automatically. If not larger than zero,
+	// it is only reverted by the next toggle.
+	DebugTimeout time.Duration
+
+	// DrainDelay enables a drain period before shutdown. If larger than zero,
+	// a signal whose HandlerFunc requests shutdown first notifies the
+	// run.Drainer Units of the Group and then waits DrainDelay, e.g. for load
+	// balancers to deregister the endpoints of the process, before initiating
+	// Group shutdown. A second termination signal cuts the drain period
+	// short. Signals whose HandlerFunc fails do not drain.
+	DrainDelay time.Duration
+
+	// ForceExitCount holds the number of termination signals, received within
+	// ForceExitWindow, after which the process exits immediately with exit
+	// code 128+signal while the Group is shutting down. A signal counts as a
+	// termination signal if its HandlerFunc returns an error, including the
+	// signal initiating the shutdown. It defaults to 2, so a second Ctrl-C
+	// forces an exit. A negative value disables forced exits.
+	// Forced exits require the Handler to be registered with a run.Group.
+	ForceExitCount int
+	// ForceExitWindow holds the period in which ForceExitCount termination
+	// signals need to be received. If not larger than zero, all termination
+	// signals received during shutdown count.
+	ForceExitWindow time.Duration
+
+	signal   chan os.Signal
+	handlers map[os.Signal]HandlerFunc
+	cancel   chan struct{}
+	mu       sync.Mutex
+	logger   telemetry.Logger
+	status   *run.Status
+	exit     func(code int)
+	stderr   io.Writer
+	debug    debugToggle
 }
 
 // Name implements run.Unit.
-func (h Handler) Name() string {
+func (h *Handler) Name() string {
 	return "signal"
 }
 
+// SetLogger implements run.LoggerSetter.
+func (h *Handler) SetLogger(l telemetry.Logger) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.logger = l
+}
+
+// ObserveStatus implements run.StatusObserver.
+func (h *Handler) ObserveStatus(s *run.Status) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.status = s
+}
+
 // PreRun implements run.PreRunner to initialize the handler.
 func (h *Handler) PreRun() error {
 	// Notify uses a non-blocking channel send. If handling a HUP and receiving
@@ -55,38 +147,168 @@ func (h *Handler) PreRun() error {
 	// channel here.
 	// E.g. https://gist.github.com/basvanbeek/c0e2ef60b73c8a5d5028ee0cf1afb576
 	h.signal = make(chan os.Signal, 2)
-	signal.Notify(h.signal,
-		syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
+	h.handlers = h.Signals
+	if h.handlers == nil {
+		h.handlers = map[os.Signal]HandlerFunc{
+			syscall.SIGHUP:  h.refresh,
+			syscall.SIGINT:  Shutdown,
+			syscall.SIGQUIT: Shutdown,
+			syscall.SIGTERM: Shutdown,
+		}
+		if h.DumpOnQuit {
+			h.handlers[syscall.SIGQUIT] = h.Dump
+		}
+		if h.DebugOnUSR1 && debugSignal != nil {
+			h.handlers[debugSignal] = h.ToggleDebug
+		}
+	}
+	signals := make([]os.Signal, 0, len(h.handlers))
+	for sig := range h.handlers {
+		signals = append(signals, sig)
+	}
+	signal.Notify(h.signal, signals...)
 	return nil
 }
 
 // ServeContext implements run.ServiceContext and listens for incoming unix
 // signals.
-// If a callback handler was registered it will be executed if a "SIGHUP" is
-// received. If the callback handler returns an error it will exit in error and
-// initiate Group shutdown if used in a run.Group environment.
+// The HandlerFunc of a received signal is executed. If it requests shutdown or
+// returns an error, ServeContext exits with that error and initiates Group
+// shutdown if used in a run.Group environment. Requested shutdowns are preceded
+// by a drain period if DrainDelay is set. The Handler keeps listening for
+// signals until the Group has shut down, forcing an exit on repeated
+// termination signals.
 func (h *Handler) ServeContext(ctx context.Context) error {
+	var received []time.Time
 	for {
 		select {
 		case sig := <-h.signal:
-			switch sig {
-			case syscall.SIGHUP:
-				if h.RefreshCallback != nil {
-					if err := h.RefreshCallback(); err != nil {
-						return fmt.Errorf("error on signal %s: %w", sig, err)
-					}
+			if err := handle(h.handlers, sig); err != nil {
+				received = append(received, time.Now())
+				if h.DrainDelay > 0 && errors.Is(err, run.ErrRequestedShutdown) {
+					received = h.drain(ctx, sig, received)
 				}
-			case syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM:
-				return fmt.Errorf("%s %w", sig, run.ErrRequestedShutdown)
+				go h.shutdown(received).run()
+				return err
 			}
 		case <-ctx.Done():
-			signal.Stop(h.signal)
-			close(h.signal)
+			go h.shutdown(received).run()
 			return nil
 		}
 	}
 }
 
+// shutdown returns the shutdown handler of the current Run.
+func (h *Handler) shutdown(received []time.Time) *shutdown {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := &shutdown{
+		signal:   h.signal,
+		handlers: h.handlers,
+		status:   h.status,
+		logger:   h.logger,
+		exit:     h.exit,
+		count:    h.ForceExitCount,
+		window:   h.ForceExitWindow,
+		received: received,
+	}
+	if s.count == 0 {
+		s.count = 2
+	}
+	if s.logger == nil {
+		s.logger = telemetry.NoopLogger()
+	}
+	if s.exit == nil {
+		s.exit = os.Exit
+	}
+	return s
+}
+
+// handle executes the HandlerFunc of the signal.
+func handle(handlers map[os.Signal]HandlerFunc, sig os.Signal) error {
+	fn := handlers[sig]
+	if fn == nil {
+		return nil
+	}
+	if err := fn(sig); err != nil {
+		if errors.Is(err, run.ErrRequestedShutdown) {
+			return err
+		}
+		return fmt.Errorf("error on signal %s: %w", sig, err)
+	}
+	return nil
+}
+
+// shutdown keeps handling signals while the Group shuts down, forcing an exit
+// on repeated termination signals.
+type shutdown struct {
+	signal   chan os.Signal
+	handlers map[os.Signal]HandlerFunc
+	status   *run.Status
+	logger   telemetry.Logger
+	exit     func(code int)
+	count    int
+	window   time.Duration
+	received []time.Time
+}
+
+func (s *shutdown) run() {
+	defer signal.Stop(s.signal)
+	if s.status == nil || s.count < 0 {
+		return
+	}
+	for {
+		select {
+		case sig := <-s.signal:
+			if handle(s.handlers, sig) == nil {
+				continue
+			}
+			if s.forceExit(time.Now()) {
+				s.logger.Error("forcing exit", fmt.Errorf("received %s during shutdown", sig),
+					"stopping", strings.Join(s.status.Stopping(), ","))
+				s.exit(exitCode(sig))
+				return
+			}
+		case <-s.status.Done():
+			return
+		}
+	}
+}
+
+// forceExit records a termination signal and reports whether the number of
+// termination signals within the window warrants a forced exit.
+func (s *shutdown) forceExit(now time.Time) bool {
+	s.received = append(s.received, now)
+	n := 0
+	for _, t := range s.received {
+		if s.window <= 0 || now.Sub(t) <= s.window {
+			n++
+		}
+	}
+	return n >= s.count
+}
+
+// exitCode returns the conventional exit code for termination by sig.
+func exitCode(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 1
+}
+
+// refresh calls the RefreshCallback, if provided.
+func (h *Handler) refresh(os.Signal) error {
+	if h.RefreshCallback != nil {
+		return h.RefreshCallback()
+	}
+	return nil
+}
+
+// send is for test purposes
+func (h *Handler) send(sig os.Signal) {
+	h.signal <- sig
+}
+
 // sendHUP is for test purposes
 func (h *Handler) sendHUP() {
 	h.signal <- syscall.SIGHUP
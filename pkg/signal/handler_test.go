@@ -16,9 +16,15 @@ package signal
 
 import (
 	"errors"
+	"fmt"
+	"os"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/tetratelabs/telemetry"
+	"github.com/tetratelabs/telemetry/function"
+
 	"github.com/tetratelabs/run"
 	"github.com/tetratelabs/run/pkg/test"
 )
@@ -108,3 +114,159 @@ func TestSignalHandlerSignals(t *testing.T) {
 
 	}
 }
+
+func TestSignalHandlerCallbacks(t *testing.T) {
+	errINT := errors.New("interrupted")
+
+	tests := []struct {
+		name    string
+		signals []os.Signal
+		err     error
+		calls   int
+	}{
+		{name: "ignore", signals: []os.Signal{syscall.SIGHUP}, err: errIRQ},
+		{name: "continue", signals: []os.Signal{syscall.SIGQUIT, syscall.SIGQUIT}, err: errIRQ, calls: 2},
+		{name: "fail", signals: []os.Signal{syscall.SIGINT}, err: errINT},
+		{name: "shutdown", signals: []os.Signal{syscall.SIGQUIT, syscall.SIGTERM}, err: nil, calls: 1},
+		{name: "unhandled", signals: []os.Signal{syscall.SIGKILL}, err: errIRQ},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				g     = run.Group{}
+				irq   = make(chan error, 1)
+				calls int
+				s     = Handler{
+					Signals: map[os.Signal]HandlerFunc{
+						syscall.SIGHUP: nil,
+						syscall.SIGQUIT: func(os.Signal) error {
+							calls++
+							return nil
+						},
+						syscall.SIGINT:  func(os.Signal) error { return errINT },
+						syscall.SIGTERM: Shutdown,
+					},
+				}
+			)
+			g.Register(&s)
+			g.Register(&test.TestSvc{
+				SvcName: "irqsvc",
+				Execute: func() error {
+					for _, sig := range tt.signals {
+						s.send(sig)
+					}
+					select {
+					case err := <-irq:
+						return err
+					case <-time.After(20 * time.Millisecond):
+						return errIRQ
+					}
+				},
+				Interrupt: func() { irq <- errIRQ },
+			})
+
+			res := make(chan error)
+			go func() { res <- g.Run() }()
+
+			select {
+			case err := <-res:
+				if !errors.Is(err, tt.err) {
+					t.Errorf("expected %v, got %v", tt.err, err)
+				}
+			case <-time.After(100 * time.Millisecond):
+				t.Fatalf("timeout")
+			}
+			if calls != tt.calls {
+				t.Errorf("expected %d calls, got %d", tt.calls, calls)
+			}
+		})
+	}
+}
+
+func TestSignalHandlerForceExit(t *testing.T) {
+	tests := []struct {
+		name    string
+		count   int
+		window  time.Duration
+		signals []os.Signal
+		code    int
+	}{
+		{name: "second signal", signals: []os.Signal{syscall.SIGINT, syscall.SIGTERM}, code: 143},
+		{name: "count", count: 3, signals: []os.Signal{syscall.SIGINT, syscall.SIGINT, syscall.SIGINT}, code: 130},
+		{name: "count not reached", count: 3, signals: []os.Signal{syscall.SIGINT, syscall.SIGINT}},
+		{name: "disabled", count: -1, signals: []os.Signal{syscall.SIGINT, syscall.SIGINT}},
+		{name: "window", window: time.Nanosecond, signals: []os.Signal{syscall.SIGINT, syscall.SIGINT}},
+		{name: "ignored", signals: []os.Signal{syscall.SIGINT, syscall.SIGHUP}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				exited  = make(chan int, 1)
+				release = make(chan struct{})
+				stopped = make(chan struct{})
+				logs    = make(chan string, 100)
+				g       = run.Group{Logger: function.NewLogger(
+					func(_ telemetry.Level, msg string, err error, values function.Values) {
+						logs <- fmt.Sprintf("%s: %v %v", msg, err, values.FromMethod)
+					})}
+				s = Handler{
+					ForceExitCount:  tt.count,
+					ForceExitWindow: tt.window,
+					exit:            func(code int) { exited <- code },
+				}
+			)
+			ready := make(chan struct{})
+			g.Register(&s, preRunner(func() error { close(ready); return nil }), &test.TestSvc{
+				SvcName: "stuck",
+				Execute: func() error {
+					<-stopped
+					<-release
+					return nil
+				},
+				Interrupt: func() { close(stopped) },
+			})
+
+			res := make(chan error)
+			go func() { res <- g.Run() }()
+			// wait for the Handler to be running
+			<-ready
+			time.Sleep(5 * time.Millisecond)
+			for _, sig := range tt.signals {
+				s.send(sig)
+				time.Sleep(5 * time.Millisecond)
+			}
+
+			select {
+			case code := <-exited:
+				if code != tt.code {
+					t.Errorf("expected exit code %d, got %d", tt.code, code)
+				}
+				var found bool
+				var lines []string
+				for len(logs) > 0 {
+					line := <-logs
+					lines = append(lines, line)
+					if line == fmt.Sprintf("forcing exit: received %s during shutdown [stopping stuck]", tt.signals[len(tt.signals)-1]) {
+						found = true
+					}
+				}
+				if !found {
+					t.Errorf("expected forced exit to be logged: %q", lines)
+				}
+			case <-time.After(50 * time.Millisecond):
+				if tt.code != 0 {
+					t.Errorf("expected forced exit")
+				}
+			}
+			close(release)
+			if err := <-res; err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+type preRunner func() error
+
+func (p preRunner) Name() string  { return "pre-runner" }
+func (p preRunner) PreRun() error { return p() }
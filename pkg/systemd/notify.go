@@ -0,0 +1,247 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package systemd implements a run.Group Unit notifying systemd about the
+// lifecycle of the Group through the sd_notify protocol.
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+
+	"github.com/tetratelabs/run"
+)
+
+// Notification socket and watchdog environment variables set by systemd.
+const (
+	EnvNotifySocket = "NOTIFY_SOCKET"
+	EnvWatchdogUSec = "WATCHDOG_USEC"
+	EnvWatchdogPID  = "WATCHDOG_PID"
+)
+
+// Readier can be implemented by Units which need time to become ready after
+// their Serve or ServeContext method started, e.g. to warm up caches.
+type Readier interface {
+	// Ready returns a channel which is closed once the Unit is ready.
+	Ready() <-chan struct{}
+}
+
+// Notifier implements a run.GroupService notifying systemd about the
+// lifecycle of the Group, for use with Type=notify services. It sends
+// STATUS=starting in its PreRun phase, READY=1 once all Services have started
+// and all WaitFor Readiers are ready, and STOPPING=1 when the Group shuts down.
+// If a watchdog is configured, it sends WATCHDOG=1 pings until the Group has
+// shut down.
+//
+// The Notifier is a no-op if no notification socket is configured, so it can
+// be registered unconditionally.
+type Notifier struct {
+	// Socket holds the path of the notification socket. If empty, the value
+	// of $NOTIFY_SOCKET is used. Paths starting with @ denote abstract
+	// sockets.
+	Socket string
+	// WatchdogInterval holds the interval of WATCHDOG=1 pings. If zero, half
+	// of $WATCHDOG_USEC is used, provided $WATCHDOG_PID is unset or holds our
+	// process id. A negative value disables the pings.
+	WatchdogInterval time.Duration
+	// WaitFor holds the Units to wait for before sending READY=1.
+	WaitFor []Readier
+
+	mu     sync.Mutex
+	conn   net.Conn
+	logger telemetry.Logger
+	status *run.Status
+}
+
+// Name implements run.Unit.
+func (n *Notifier) Name() string {
+	return "systemd"
+}
+
+// SetLogger implements run.LoggerSetter.
+func (n *Notifier) SetLogger(l telemetry.Logger) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.logger = l
+}
+
+// ObserveStatus implements run.StatusObserver.
+func (n *Notifier) ObserveStatus(s *run.Status) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.status = s
+}
+
+// PreRun implements run.PreRunner, connecting to the notification socket.
+func (n *Notifier) PreRun() error {
+	if n.Socket == "" {
+		n.Socket = os.Getenv(EnvNotifySocket)
+	}
+	if n.WatchdogInterval == 0 {
+		n.WatchdogInterval = watchdogInterval()
+	}
+	if n.Socket == "" {
+		return nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: n.Socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("systemd notify socket: %w", err)
+	}
+	n.mu.Lock()
+	n.conn = conn
+	status := n.status
+	n.mu.Unlock()
+	if status != nil {
+		go func() {
+			<-status.Done()
+			n.close(conn)
+		}()
+	}
+	return n.Notify("STATUS=starting")
+}
+
+// ServeContext implements run.ServiceContext. It sends READY=1 once all
+// Services have started and the WaitFor Readiers are ready, and STOPPING=1
+// when the Group shuts down.
+func (n *Notifier) ServeContext(ctx context.Context) error {
+	n.mu.Lock()
+	conn, status := n.conn, n.status
+	n.mu.Unlock()
+	if conn == nil {
+		<-ctx.Done()
+		return nil
+	}
+
+	var watchdog <-chan time.Time
+	if n.WatchdogInterval > 0 {
+		t := time.NewTicker(n.WatchdogInterval)
+		defer t.Stop()
+		watchdog = t.C
+	}
+
+	ready := n.ready(ctx)
+	for {
+		select {
+		case <-ready:
+			ready = nil
+			n.notify("READY=1", "STATUS=serving")
+		case <-watchdog:
+			n.notify("WATCHDOG=1")
+		case <-ctx.Done():
+			n.notify("STOPPING=1", "STATUS=stopping")
+			if status == nil {
+				n.close(conn)
+			} else if watchdog != nil {
+				go n.keepAlive(status)
+			}
+			return nil
+		}
+	}
+}
+
+// Notify sends the provided newline separated state assignments, like
+// STATUS=reloading, to the notification socket. It is a no-op if no
+// notification socket is configured.
+func (n *Notifier) Notify(state string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.conn == nil {
+		return nil
+	}
+	if _, err := n.conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("systemd notify: %w", err)
+	}
+	return nil
+}
+
+// notify sends the state assignments, logging failures.
+func (n *Notifier) notify(assignments ...string) {
+	if err := n.Notify(strings.Join(assignments, "\n")); err != nil {
+		n.mu.Lock()
+		logger := n.logger
+		n.mu.Unlock()
+		if logger != nil {
+			logger.Error("sd_notify failed", err)
+		}
+	}
+}
+
+// ready returns a channel which is closed once all WaitFor Readiers are ready
+// or ctx is done.
+func (n *Notifier) ready(ctx context.Context) <-chan struct{} {
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		for _, r := range n.WaitFor {
+			select {
+			case <-r.Ready():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// keepAlive keeps the watchdog alive while the Group shuts down.
+func (n *Notifier) keepAlive(status *run.Status) {
+	t := time.NewTicker(n.WatchdogInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			n.notify("WATCHDOG=1")
+		case <-status.Done():
+			return
+		}
+	}
+}
+
+// close closes the connection to the notification socket.
+func (n *Notifier) close(conn net.Conn) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	_ = conn.Close()
+	if n.conn == conn {
+		n.conn = nil
+	}
+}
+
+// watchdogInterval returns half of the watchdog timeout configured by systemd
+// for our process, or zero if none is.
+func watchdogInterval() time.Duration {
+	if pid := os.Getenv(EnvWatchdogPID); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv(EnvWatchdogUSec), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+var (
+	_ run.PreRunner      = (*Notifier)(nil)
+	_ run.ServiceContext = (*Notifier)(nil)
+	_ run.LoggerSetter   = (*Notifier)(nil)
+	_ run.StatusObserver = (*Notifier)(nil)
+)
@@ -0,0 +1,165 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systemd
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+
+	"github.com/tetratelabs/run"
+	"github.com/tetratelabs/run/pkg/test"
+)
+
+type readier chan struct{}
+
+func (r readier) Ready() <-chan struct{} { return r }
+
+// listen returns a notification socket and a channel with its datagrams.
+func listen(t *testing.T) (string, <-chan string) {
+	// keep the path short, socket paths are limited to ~100 bytes
+	dir, err := os.MkdirTemp("", "sd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+		_ = os.RemoveAll(dir)
+	})
+
+	msgs := make(chan string, 100)
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			msgs <- string(buf[:n])
+		}
+	}()
+	return path, msgs
+}
+
+// next returns the next datagram which is not a watchdog ping.
+func next(t *testing.T, msgs <-chan string, pings *int) string {
+	t.Helper()
+	for {
+		select {
+		case msg := <-msgs:
+			if msg == "WATCHDOG=1" {
+				*pings++
+				continue
+			}
+			return msg
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for notification")
+			return ""
+		}
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	var (
+		socket, msgs = listen(t)
+		ready        = make(readier)
+		stop         = make(chan struct{})
+		pings        int
+		g            = run.Group{Logger: telemetry.NoopLogger()}
+		n            = Notifier{Socket: socket, WatchdogInterval: 5 * time.Millisecond, WaitFor: []Readier{ready}}
+		errStop      = errors.New("stop")
+	)
+	g.Register(&n, &test.TestSvc{
+		SvcName: "svc",
+		Execute: func() error { <-stop; return errStop },
+	})
+
+	res := make(chan error)
+	go func() { res <- g.Run() }()
+
+	if want, have := "STATUS=starting", next(t, msgs, &pings); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(ready)
+	if want, have := "READY=1\nSTATUS=serving", next(t, msgs, &pings); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	if pings == 0 {
+		t.Error("expected watchdog pings before ready")
+	}
+	close(stop)
+	if want, have := "STOPPING=1\nSTATUS=stopping", next(t, msgs, &pings); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	if err := <-res; !errors.Is(err, errStop) {
+		t.Errorf("expected %v, got %v", errStop, err)
+	}
+}
+
+func TestNotifierDisabled(t *testing.T) {
+	defer os.Setenv(EnvNotifySocket, os.Getenv(EnvNotifySocket))
+	os.Unsetenv(EnvNotifySocket)
+
+	var (
+		g       = run.Group{Logger: telemetry.NoopLogger()}
+		n       Notifier
+		errStop = errors.New("stop")
+	)
+	g.Register(&n, &test.TestSvc{
+		SvcName: "svc",
+		Execute: func() error { return errStop },
+	})
+	if err := g.Run(); !errors.Is(err, errStop) {
+		t.Fatalf("expected %v, got %v", errStop, err)
+	}
+	if err := n.Notify("STATUS=test"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	defer os.Setenv(EnvWatchdogUSec, os.Getenv(EnvWatchdogUSec))
+	defer os.Setenv(EnvWatchdogPID, os.Getenv(EnvWatchdogPID))
+
+	tests := []struct {
+		usec, pid string
+		want      time.Duration
+	}{
+		{usec: "", want: 0},
+		{usec: "invalid", want: 0},
+		{usec: "20000000", want: 10 * time.Second},
+		{usec: "20000000", pid: strconv.Itoa(os.Getpid()), want: 10 * time.Second},
+		{usec: "20000000", pid: "1", want: 0},
+	}
+	for _, tt := range tests {
+		os.Setenv(EnvWatchdogUSec, tt.usec)
+		os.Setenv(EnvWatchdogPID, tt.pid)
+		if have := watchdogInterval(); tt.want != have {
+			t.Errorf("usec %q pid %q: want %v, have %v", tt.usec, tt.pid, tt.want, have)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// FlagError is returned when a flag value violates one of the declarative
+// rules of its FlagSet.
+type FlagError struct {
+	// Flag holds the name of the offending flag, including its namespace.
+	Flag string
+	// Reason describes the violated rule.
+	Reason string
+}
+
+// Error implements error.
+func (e FlagError) Error() string {
+	return "--" + e.Flag + ": " + e.Reason
+}
+
+type ruleKind int
+
+const (
+	ruleRequired ruleKind = iota
+	ruleExclusive
+	ruleTogether
+	ruleRange
+	ruleEnum
+	ruleRegex
+	ruleFile
+	ruleDir
+)
+
+// flagRule holds a declarative validation rule for one or more flags.
+type flagRule struct {
+	kind     ruleKind
+	names    []string
+	min, max float64
+	values   []string
+	re       *regexp.Regexp
+}
+
+// MarkRequired marks the named flags as required. A flag is considered set if
+// it was provided on the command line or in the config file.
+func (f *FlagSet) MarkRequired(names ...string) {
+	for _, name := range names {
+		f.rules = append(f.rules, flagRule{kind: ruleRequired, names: []string{name}})
+	}
+}
+
+// MutuallyExclusive marks the named flags as mutually exclusive, allowing at
+// most one of them to be set.
+func (f *FlagSet) MutuallyExclusive(names ...string) {
+	f.rules = append(f.rules, flagRule{kind: ruleExclusive, names: names})
+}
+
+// RequiredTogether marks the named flags as belonging together: if one of
+// them is set, all of them need to be set.
+func (f *FlagSet) RequiredTogether(names ...string) {
+	f.rules = append(f.rules, flagRule{kind: ruleTogether, names: names})
+}
+
+// Range requires the numeric value of the named flag to be within min and
+// max, inclusive. For slice flags each element is checked. The range is only
+// checked if the flag was set, so the default can be outside of the range,
+// e.g. 0 to disable an optional port.
+func (f *FlagSet) Range(name string, min, max float64) {
+	f.rules = append(f.rules, flagRule{kind: ruleRange, names: []string{name}, min: min, max: max})
+}
+
+// Enum requires the value of the named flag to be one of the provided values.
+// For slice flags each element is checked. Empty values are allowed; use
+// MarkRequired to enforce a value.
+//
+// The values are also offered by the generated shell completion scripts.
+func (f *FlagSet) Enum(name string, values ...string) {
+	f.rules = append(f.rules, flagRule{kind: ruleEnum, names: []string{name}, values: values})
+}
+
+// Regex requires the value of the named flag to match the provided regular
+// expression. For slice flags each element is checked. Empty values are
+// allowed; use MarkRequired to enforce a value.
+func (f *FlagSet) Regex(name string, re *regexp.Regexp) {
+	f.rules = append(f.rules, flagRule{kind: ruleRegex, names: []string{name}, re: re})
+}
+
+// ExistingFile requires the value of the named flag to be the path of an
+// existing regular file. Empty values are allowed; use MarkRequired to enforce
+// a value.
+func (f *FlagSet) ExistingFile(name string) {
+	f.rules = append(f.rules, flagRule{kind: ruleFile, names: []string{name}})
+}
+
+// ExistingDir requires the value of the named flag to be the path of an
+// existing directory. Empty values are allowed; use MarkRequired to enforce a
+// value.
+func (f *FlagSet) ExistingDir(name string) {
+	f.rules = append(f.rules, flagRule{kind: ruleDir, names: []string{name}})
+}
+
+// checkRules evaluates the rules of the FlagSet and returns all violations.
+func (f *FlagSet) checkRules() []error {
+	if f == nil {
+		return nil
+	}
+	var errs []error
+	for _, r := range f.rules {
+		errs = append(errs, r.check(f)...)
+	}
+	return errs
+}
+
+func (r flagRule) check(fs *FlagSet) []error {
+	flags := make([]*pflag.Flag, 0, len(r.names))
+	for _, name := range r.names {
+		f := fs.Lookup(name)
+		if f == nil {
+			return []error{FlagError{Flag: name, Reason: "rule references unknown flag"}}
+		}
+		flags = append(flags, f)
+	}
+
+	switch r.kind {
+	case ruleRequired:
+		if !flags[0].Changed {
+			return []error{FlagError{Flag: flags[0].Name, Reason: "required flag not set"}}
+		}
+		return nil
+	case ruleExclusive:
+		var set []*pflag.Flag
+		for _, f := range flags {
+			if f.Changed {
+				set = append(set, f)
+			}
+		}
+		if len(set) > 1 {
+			return []error{FlagError{
+				Flag:   set[0].Name,
+				Reason: "can't be combined with " + flagList(set[1:]),
+			}}
+		}
+		return nil
+	case ruleTogether:
+		var set, unset []*pflag.Flag
+		for _, f := range flags {
+			if f.Changed {
+				set = append(set, f)
+			} else {
+				unset = append(unset, f)
+			}
+		}
+		if len(set) > 0 && len(unset) > 0 {
+			return []error{FlagError{
+				Flag:   set[0].Name,
+				Reason: "requires " + flagList(unset) + " to be set as well",
+			}}
+		}
+		return nil
+	}
+
+	if r.kind == ruleRange && !flags[0].Changed {
+		// the default of an unset flag may purposely be out of range
+		return nil
+	}
+	var errs []error
+	for _, v := range flagValues(flags[0]) {
+		if reason := r.checkValue(v); reason != "" {
+			errs = append(errs, FlagError{Flag: flags[0].Name, Reason: reason})
+		}
+	}
+	return errs
+}
+
+// checkValue returns the reason a single value violates the rule, if any.
+func (r flagRule) checkValue(v string) string {
+	if v == "" && r.kind != ruleRange {
+		return ""
+	}
+	switch r.kind {
+	case ruleRange:
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Sprintf("value %q is not a number", v)
+		}
+		if n < r.min || n > r.max {
+			return fmt.Sprintf("value %s out of range [%s, %s]", v, formatFloat(r.min), formatFloat(r.max))
+		}
+	case ruleEnum:
+		for _, allowed := range r.values {
+			if v == allowed {
+				return ""
+			}
+		}
+		return fmt.Sprintf("value %q must be one of: %s", v, strings.Join(r.values, ", "))
+	case ruleRegex:
+		if !r.re.MatchString(v) {
+			return fmt.Sprintf("value %q does not match %s", v, r.re)
+		}
+	case ruleFile:
+		if fi, err := os.Stat(v); err != nil || !fi.Mode().IsRegular() {
+			return fmt.Sprintf("file %q does not exist", v)
+		}
+	case ruleDir:
+		if fi, err := os.Stat(v); err != nil || !fi.IsDir() {
+			return fmt.Sprintf("directory %q does not exist", v)
+		}
+	}
+	return ""
+}
+
+// note returns the documentation note of the rule for the named flag.
+func (r flagRule) note(name string) string {
+	var others []string
+	for _, n := range r.names {
+		if n != name {
+			others = append(others, "--"+n)
+		}
+	}
+	switch r.kind {
+	case ruleRequired:
+		return "required"
+	case ruleExclusive:
+		return "excludes " + strings.Join(others, ", ")
+	case ruleTogether:
+		return "requires " + strings.Join(others, ", ")
+	case ruleRange:
+		return "range: " + formatFloat(r.min) + ".." + formatFloat(r.max)
+	case ruleEnum:
+		return "one of: " + strings.Join(r.values, ", ")
+	case ruleRegex:
+		return "pattern: " + r.re.String()
+	case ruleFile:
+		return "existing file"
+	case ruleDir:
+		return "existing directory"
+	}
+	return ""
+}
+
+// ruleNotes returns the documentation notes of the rules for the named flag.
+func (f *FlagSet) ruleNotes(name string) []string {
+	var notes []string
+	for _, r := range f.rules {
+		for _, n := range r.names {
+			if n == name {
+				notes = append(notes, r.note(name))
+				break
+			}
+		}
+	}
+	return notes
+}
+
+// ruleCompletions returns the shell completions implied by the rules of the
+// FlagSet, keyed by flag name.
+func (f *FlagSet) ruleCompletions() map[string]Completion {
+	if f == nil {
+		return nil
+	}
+	completions := make(map[string]Completion)
+	for _, r := range f.rules {
+		name := r.names[0]
+		switch r.kind {
+		case ruleEnum:
+			completions[name] = Completion{Values: r.values}
+		case ruleFile:
+			completions[name] = Completion{Files: true}
+		case ruleDir:
+			completions[name] = Completion{Dirs: true}
+		}
+	}
+	return completions
+}
+
+// flagValues returns the individual values of a flag.
+func flagValues(f *pflag.Flag) []string {
+	if sv, ok := f.Value.(pflag.SliceValue); ok {
+		return sv.GetSlice()
+	}
+	return []string{f.Value.String()}
+}
+
+func flagList(flags []*pflag.Flag) string {
+	names := make([]string, 0, len(flags))
+	for _, f := range flags {
+		names = append(names, "--"+f.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
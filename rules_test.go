@@ -0,0 +1,155 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/tetratelabs/telemetry"
+
+	"github.com/tetratelabs/run"
+)
+
+func TestFlagRules(t *testing.T) {
+	dir := t.TempDir()
+	for _, tt := range []struct {
+		args       []string
+		namespaced bool
+		want       []string
+	}{
+		{
+			args: []string{"--port", "80", "--mode", "fast", "--data", dir},
+		},
+		{
+			args: []string{"--mode", "fast", "--tags", "a1"},
+			want: []string{"--port: required flag not set"},
+		},
+		{
+			args: []string{
+				"--port", "70000", "--mode", "medium", "--tags", "a1,B2",
+				"--cert", "c", "--data", dir + "/missing",
+			},
+			want: []string{
+				"--port: value 70000 out of range [1, 65535]",
+				`--mode: value "medium" must be one of: fast, slow`,
+				`--tags: value "B2" does not match ^[a-z][0-9]$`,
+				"--cert: requires --key to be set as well",
+				"directory \"" + dir + "/missing\" does not exist",
+			},
+		},
+		{
+			args: []string{"--port", "80", "--debug-port", "0"},
+			want: []string{"--debug-port: value 0 out of range [1, 65535]"},
+		},
+		{
+			args: []string{"--port", "80", "--mode", "fast", "--cert", "c", "--key", "k", "--insecure"},
+			want: []string{"--cert: can't be combined with --insecure"},
+		},
+		{
+			args:       []string{"--rules.mode", "slow"},
+			namespaced: true,
+			want:       []string{"--rules.port: required flag not set"},
+		},
+	} {
+		var (
+			unit = rulesConfig{namespaced: tt.namespaced}
+			g    = run.Group{Logger: telemetry.NoopLogger(), FlagNamespaces: true}
+		)
+		g.Register(&unit)
+		err := g.RunConfig(tt.args...)
+		if len(tt.want) == 0 {
+			if err != nil {
+				t.Errorf("%v: unexpected error: %v", tt.args, err)
+			}
+			if !unit.validated {
+				t.Errorf("%v: expected Validate to be called", tt.args)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%v: expected error", tt.args)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%v: expected error to contain %q, got: %v", tt.args, want, err)
+			}
+		}
+		if unit.validated {
+			t.Errorf("%v: expected Validate to be skipped on rule violations", tt.args)
+		}
+	}
+}
+
+func TestFlagRulesCompletion(t *testing.T) {
+	g := run.Group{Logger: telemetry.NoopLogger()}
+	g.Register(&rulesConfig{})
+
+	have := captureStdout(t, func() { _ = g.RunConfig("--completion", "bash") })
+	for _, want := range []string{`compgen -W 'fast slow'`, "--data)\n\t\t\tCOMPREPLY=( $(compgen -d"} {
+		if !strings.Contains(have, want) {
+			t.Errorf("expected script to contain %q:\n%s", want, have)
+		}
+	}
+}
+
+type rulesConfig struct {
+	namespaced bool
+	validated  bool
+	port       int
+	debugPort  int
+	mode, data string
+	cert, key  string
+	insecure   bool
+	tags       []string
+}
+
+func (r rulesConfig) Name() string { return "rules" }
+
+func (r rulesConfig) FlagNamespace() string {
+	if r.namespaced {
+		return "rules"
+	}
+	return ""
+}
+
+func (r *rulesConfig) FlagSet() *run.FlagSet {
+	flags := run.NewFlagSet("rules config")
+	flags.IntVar(&r.port, "port", 0, "port")
+	flags.IntVar(&r.debugPort, "debug-port", 0, "debug port, 0 disables")
+	flags.StringVar(&r.mode, "mode", "", "mode")
+	flags.StringVar(&r.data, "data", "", "data dir")
+	flags.StringVar(&r.cert, "cert", "", "cert file")
+	flags.StringVar(&r.key, "key", "", "key file")
+	flags.BoolVar(&r.insecure, "insecure", false, "insecure")
+	flags.StringSliceVar(&r.tags, "tags", nil, "tags")
+
+	flags.MarkRequired("port")
+	flags.Range("port", 1, 65535)
+	flags.Range("debug-port", 1, 65535)
+	flags.Enum("mode", "fast", "slow")
+	flags.Regex("tags", regexp.MustCompile(`^[a-z][0-9]$`))
+	flags.ExistingDir("data")
+	flags.RequiredTogether("cert", "key")
+	flags.MutuallyExclusive("cert", "insecure")
+	return flags
+}
+
+func (r *rulesConfig) Validate() error {
+	r.validated = true
+	return nil
+}
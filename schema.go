@@ -0,0 +1,210 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// schemaDraft holds the JSON Schema dialect of the generated schema.
+const schemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// nonConfigFlags holds the Common Service options that do not configure the
+// application and are therefore omitted from the JSON Schema.
+var nonConfigFlags = map[string]bool{
+	"help":        true,
+	"help-all":    true,
+	"version":     true,
+	"color":       true,
+	"config-file": true,
+}
+
+// jsonSchema holds the subset of JSON Schema used to describe flags.
+type jsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	AdditionalProperties interface{}            `json:"additionalProperties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	Enum                 []interface{}          `json:"enum,omitempty"`
+	Default              interface{}            `json:"default,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Deprecated           bool                   `json:"deprecated,omitempty"`
+	WriteOnly            bool                   `json:"writeOnly,omitempty"`
+}
+
+// WriteSchema writes a JSON Schema describing the configuration accepted by
+// the Group to w. The schema describes an object holding one property per
+// flag of the Common Service options and all Config Units, matching the
+// "flag-name = value" entries of config files. It covers the flag types,
+// defaults, descriptions, the declared rules (enums, ranges, patterns and
+// required flags) and deprecation. Hidden flags and flags not configuring the
+// application, like --help, are omitted. Defaults of secret flags are left
+// out.
+//
+// Like WriteDocs, WriteSchema can be used before RunConfig is called, e.g. to
+// validate deployment manifests offline, without affecting a later Run. The
+// same output can be requested from a Group enabled binary through the hidden
+// --generate-schema flag.
+func (g *Group) WriteSchema(w io.Writer) error {
+	if g.f == nil {
+		defer g.registerFlagsOnly()()
+	}
+
+	// collect the rules of all FlagSets by (namespaced) flag name
+	rules := make(map[string][]flagRule)
+	for _, fs := range g.fs {
+		if fs == nil {
+			continue
+		}
+		for _, r := range fs.rules {
+			for _, name := range r.names {
+				rules[name] = append(rules[name], r)
+			}
+		}
+	}
+
+	s := &jsonSchema{
+		Schema:               schemaDraft,
+		Title:                g.usageName(),
+		Description:          strings.TrimSpace(g.helpText()),
+		Type:                 "object",
+		Properties:           make(map[string]*jsonSchema),
+		AdditionalProperties: false,
+	}
+	g.f.VisitAll(func(f *pflag.Flag) {
+		if f.Hidden || nonConfigFlags[f.Name] {
+			return
+		}
+		p := flagSchema(f)
+		for _, r := range rules[f.Name] {
+			switch r.kind {
+			case ruleRequired:
+				s.Required = append(s.Required, f.Name)
+			case ruleRange:
+				min, max := r.min, r.max
+				items(p).Minimum, items(p).Maximum = &min, &max
+			case ruleEnum:
+				for _, v := range r.values {
+					items(p).Enum = append(items(p).Enum, typedValue(items(p).Type, v))
+				}
+			case ruleRegex:
+				items(p).Pattern = r.re.String()
+			}
+		}
+		s.Properties[f.Name] = p
+	})
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// flagSchema returns the JSON Schema of a single flag.
+func flagSchema(f *pflag.Flag) *jsonSchema {
+	_, usage := pflag.UnquoteUsage(f)
+	p := &jsonSchema{Description: usage}
+
+	typ := f.Value.Type()
+	switch {
+	case typ == "stringToString" || typ == "stringToInt" || typ == "stringToInt64":
+		p.Type = "object"
+		valueType := "string"
+		if typ != "stringToString" {
+			valueType = "integer"
+		}
+		p.AdditionalProperties = &jsonSchema{Type: valueType}
+	case strings.HasSuffix(typ, "Slice") || strings.HasSuffix(typ, "Array"):
+		p.Type = "array"
+		p.Items = &jsonSchema{Type: scalarType(strings.TrimSuffix(strings.TrimSuffix(typ, "Slice"), "Array"))}
+		if !zeroDefault(f) {
+			var def []interface{}
+			for _, v := range parseDefaultSlice(f.DefValue) {
+				def = append(def, typedValue(p.Items.Type, v))
+			}
+			p.Default = def
+		}
+	default:
+		p.Type = scalarType(typ)
+		if f.DefValue != "" {
+			p.Default = typedValue(p.Type, f.DefValue)
+		}
+	}
+
+	if isSecret(f) {
+		p.Default = nil
+		p.WriteOnly = true
+	}
+	if a, ok := f.Value.(*aliasValue); ok {
+		p.Deprecated = true
+		p.Description = "deprecated: use " + strings.TrimSuffix(f.Name, a.name) + a.target + " instead"
+	}
+	if f.Deprecated != "" {
+		p.Deprecated = true
+		p.Description = strings.TrimSpace(p.Description + " (deprecated: " + f.Deprecated + ")")
+	}
+	return p
+}
+
+// items returns the schema holding the constraints of individual values.
+func items(p *jsonSchema) *jsonSchema {
+	if p.Items != nil {
+		return p.Items
+	}
+	return p
+}
+
+// scalarType returns the JSON Schema type of a pflag value type.
+func scalarType(typ string) string {
+	switch typ {
+	case "bool":
+		return "boolean"
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "count":
+		return "integer"
+	case "float32", "float64":
+		return "number"
+	}
+	return "string"
+}
+
+// typedValue converts a flag value to the JSON type of the schema type, if
+// possible.
+func typedValue(typ, v string) interface{} {
+	switch typ {
+	case "boolean":
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	case "integer":
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return i
+		}
+	case "number":
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return v
+}
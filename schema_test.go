@@ -0,0 +1,78 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/tetratelabs/telemetry"
+
+	"github.com/tetratelabs/run"
+)
+
+func TestWriteSchema(t *testing.T) {
+	g := run.Group{Name: "mytool", HelpText: "my tool", Logger: telemetry.NoopLogger()}
+	g.Register(&rulesConfig{}, &aliasConfig{}, &secretConfig{})
+
+	var buf bytes.Buffer
+	if err := g.WriteSchema(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &schema); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+	}
+
+	props := schema["properties"].(map[string]interface{})
+	for name, want := range map[string]map[string]interface{}{
+		"name":        {"type": "string", "default": "mytool", "description": "name of this service"},
+		"port":        {"type": "integer", "default": 0.0, "minimum": 1.0, "maximum": 65535.0, "description": "port"},
+		"mode":        {"type": "string", "enum": []interface{}{"fast", "slow"}, "description": "mode"},
+		"insecure":    {"type": "boolean", "default": false, "description": "insecure"},
+		"tags":        {"type": "array", "items": map[string]interface{}{"type": "string", "pattern": "^[a-z][0-9]$"}, "description": "tags"},
+		"addr":        {"type": "string", "deprecated": true, "description": "deprecated: use listen-addr instead"},
+		"listen-addr": {"type": "string", "default": "localhost", "description": "listen address"},
+		"token":       {"type": "string", "writeOnly": true, "description": "api token"},
+	} {
+		if have := props[name]; !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: want %v, have %v", name, want, have)
+		}
+	}
+	for _, name := range []string{"help", "version", "completion", "generate-schema"} {
+		if _, ok := props[name]; ok {
+			t.Errorf("expected %s to be omitted", name)
+		}
+	}
+	if want, have := []interface{}{"port"}, schema["required"]; !reflect.DeepEqual(want, have) {
+		t.Errorf("required: want %v, have %v", want, have)
+	}
+	if want, have := false, schema["additionalProperties"]; want != have {
+		t.Errorf("additionalProperties: want %v, have %v", want, have)
+	}
+
+	g = run.Group{Name: "mytool", HelpText: "my tool", Logger: telemetry.NoopLogger()}
+	g.Register(&rulesConfig{}, &aliasConfig{}, &secretConfig{})
+	have := captureStdout(t, func() {
+		if err := g.RunConfig("--generate-schema"); err != run.ErrBailEarlyRequest {
+			t.Errorf("expected bail early request, got %v", err)
+		}
+	})
+	if have != buf.String() {
+		t.Errorf("expected --generate-schema to match WriteSchema:\n%s", have)
+	}
+}
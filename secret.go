@@ -0,0 +1,276 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/pflag"
+	"github.com/tetratelabs/multierror"
+)
+
+// redacted replaces the values of secret flags in output and logs.
+const redacted = "[redacted]"
+
+// MarkSecret marks the named flag as secret. The values of secret flags are
+// redacted from help output, generated documentation and the errors logged by
+// Group.
+//
+// To keep secrets out of process listings, a companion --<name>-file flag is
+// registered which reads the value from the provided file. Trailing newlines
+// are stripped from the file contents.
+func (f *FlagSet) MarkSecret(name string) error {
+	flag := f.Lookup(name)
+	if flag == nil {
+		return FlagError{Flag: name, Reason: "flag does not exist"}
+	}
+	if _, ok := flag.Value.(secret); !ok {
+		sv := &secretValue{Value: flag.Value, name: name}
+		if _, isSlice := flag.Value.(pflag.SliceValue); isSlice {
+			flag.Value = &secretSliceValue{secretValue: sv}
+		} else {
+			flag.Value = sv
+		}
+	}
+	if f.Lookup(name+"-file") == nil {
+		f.String(name+"-file", "", secretFileUsage(name))
+		f.ExistingFile(name + "-file")
+	}
+	return nil
+}
+
+// SecretEnv marks the named flag as secret (see MarkSecret) and allows its
+// value to be provided by the env environment variable. The environment
+// variable is only consulted if neither the flag nor its companion -file flag
+// was set. If Group namespaces the flag, the environment variable is prefixed
+// by the upper cased namespace, e.g. $CACHE_TOKEN for namespace "cache" and
+// env "TOKEN", so multiple instances of a Unit don't share their secrets.
+func (f *FlagSet) SecretEnv(name, env string) error {
+	if err := f.MarkSecret(name); err != nil {
+		return err
+	}
+	f.Lookup(name).Value.(secret).secret().env = env
+	return nil
+}
+
+// secret is implemented by the Value wrappers of secret flags.
+type secret interface {
+	secret() *secretValue
+}
+
+// secretValue wraps the Value of a secret flag and records all values it was
+// given, so they can be redacted from error messages. This includes invalid
+// values, which pflag echoes in its parse errors.
+type secretValue struct {
+	pflag.Value
+	name string
+	env  string
+	mu   sync.Mutex
+	seen []string
+}
+
+func (s *secretValue) secret() *secretValue { return s }
+
+func (s *secretValue) record(values ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		var found bool
+		for _, seen := range s.seen {
+			if seen == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			s.seen = append(s.seen, v)
+		}
+	}
+}
+
+func (s *secretValue) values() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.seen...)
+}
+
+// Set implements pflag.Value.
+func (s *secretValue) Set(v string) error {
+	s.record(v)
+	return s.Value.Set(v)
+}
+
+// secretSliceValue wraps the Value of a secret slice flag.
+type secretSliceValue struct {
+	*secretValue
+}
+
+// Append implements pflag.SliceValue.
+func (s *secretSliceValue) Append(v string) error {
+	s.record(v)
+	return s.Value.(pflag.SliceValue).Append(v)
+}
+
+// Replace implements pflag.SliceValue.
+func (s *secretSliceValue) Replace(values []string) error {
+	s.record(values...)
+	return s.Value.(pflag.SliceValue).Replace(values)
+}
+
+// GetSlice implements pflag.SliceValue.
+func (s *secretSliceValue) GetSlice() []string {
+	return s.Value.(pflag.SliceValue).GetSlice()
+}
+
+// isSecret returns true if the flag was marked as secret.
+func isSecret(f *pflag.Flag) bool {
+	_, ok := f.Value.(secret)
+	return ok
+}
+
+// secretFileUsage returns the help text of the companion -file flag of the
+// named secret flag.
+func secretFileUsage(name string) string {
+	return "read --" + name + " from file"
+}
+
+// secretEnv returns the environment variable of a secret flag, if any,
+// prefixed by the namespace of the flag.
+func secretEnv(f *pflag.Flag) string {
+	s, ok := f.Value.(secret)
+	if !ok || s.secret().env == "" {
+		return ""
+	}
+	ns := strings.TrimSuffix(strings.TrimSuffix(f.Name, s.secret().name), ".")
+	if ns == "" {
+		return s.secret().env
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, ns) + "_" + s.secret().env
+}
+
+// resolveSecrets sets the secret flags not provided on the command line or in
+// the config file from their companion -file flag or environment variable.
+func (g *Group) resolveSecrets() error {
+	var err error
+	for _, fs := range g.fs {
+		if fs == nil {
+			continue
+		}
+		fs.VisitAll(func(f *pflag.Flag) {
+			if !isSecret(f) {
+				return
+			}
+			var (
+				env    = secretEnv(f)
+				file   = fs.Lookup(f.Name + "-file")
+				value  string
+				source string
+			)
+			switch {
+			case file != nil && file.Value.String() != "":
+				if f.Changed {
+					err = multierror.Append(err, FlagError{
+						Flag:   f.Name,
+						Reason: "can't be combined with --" + file.Name,
+					})
+					return
+				}
+				b, rErr := os.ReadFile(file.Value.String())
+				if rErr != nil {
+					err = multierror.Append(err, FlagError{Flag: file.Name, Reason: rErr.Error()})
+					return
+				}
+				value, source = strings.TrimRight(string(b), "\r\n"), "--"+file.Name
+			case !f.Changed && env != "":
+				var found bool
+				if value, found = os.LookupEnv(env); !found {
+					return
+				}
+				source = "$" + env
+			default:
+				return
+			}
+			if sErr := f.Value.Set(value); sErr != nil {
+				err = multierror.Append(err, FlagError{
+					Flag:   f.Name,
+					Reason: "invalid value from " + source + ": " + sErr.Error(),
+				})
+				return
+			}
+			f.Changed = true
+		})
+	}
+	return err
+}
+
+// secretValues returns all values seen by secret flags, longest first.
+func (g *Group) secretValues() []string {
+	if g.f == nil {
+		return nil
+	}
+	var values []string
+	g.f.VisitAll(func(f *pflag.Flag) {
+		if s, ok := f.Value.(secret); ok {
+			values = append(values, s.secret().values()...)
+			if !zeroDefault(f) {
+				values = append(values, f.DefValue)
+			}
+		}
+	})
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	return values
+}
+
+// redact returns err with the values of secret flags masked in its message.
+// The original error remains available through errors.Is and errors.As.
+func (g *Group) redact(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	for _, v := range g.secretValues() {
+		msg = strings.ReplaceAll(msg, v, redacted)
+	}
+	if msg == err.Error() {
+		return err
+	}
+	return redactedError{err: err, msg: msg}
+}
+
+// redactedError holds an error with secret values masked from its message.
+type redactedError struct {
+	err error
+	msg string
+}
+
+// Error implements error.
+func (e redactedError) Error() string { return e.msg }
+
+// Unwrap returns the original error.
+func (e redactedError) Unwrap() error { return e.err }
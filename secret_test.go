@@ -0,0 +1,151 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+
+	"github.com/tetratelabs/run"
+)
+
+func TestSecretFlags(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	writeFile(t, tokenFile, "from-file\n")
+	t.Setenv("TEST_API_TOKEN", "from-env")
+
+	for _, tt := range []struct {
+		args []string
+		want string
+		err  string
+	}{
+		{args: []string{"--token", "from-cli"}, want: "from-cli"},
+		{args: []string{"--token-file", tokenFile}, want: "from-file"},
+		{args: []string{"--pin", "1234"}, want: "from-env"},
+		{args: []string{"--token", "x", "--token-file", tokenFile}, err: "--token: can't be combined with --token-file"},
+		{args: []string{"--token-file", tokenFile + ".missing"}, err: "--token-file: "},
+	} {
+		var (
+			unit = secretConfig{}
+			g    = run.Group{Logger: telemetry.NoopLogger()}
+		)
+		g.Register(&unit)
+		err := g.RunConfig(tt.args...)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%v: expected error containing %q, got %v", tt.args, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", tt.args, err)
+		}
+		if unit.token != tt.want {
+			t.Errorf("%v: want token %q, have %q", tt.args, tt.want, unit.token)
+		}
+	}
+}
+
+func TestSecretRedaction(t *testing.T) {
+	for _, args := range [][]string{
+		{"--token", "leaked-token"},
+		{"--pin", "leaked-token"},
+	} {
+		g := run.Group{Logger: telemetry.NoopLogger()}
+		g.Register(&secretConfig{})
+		err := g.RunConfig(args...)
+		if err == nil {
+			t.Errorf("%v: expected error", args)
+			continue
+		}
+		if strings.Contains(err.Error(), "leaked-token") || !strings.Contains(err.Error(), "[redacted]") {
+			t.Errorf("%v: expected secret to be redacted, got: %v", args, err)
+		}
+	}
+
+	g := run.Group{Logger: telemetry.NoopLogger()}
+	g.Register(&secretConfig{})
+	have := captureStdout(t, func() { _ = g.RunConfig("--help") })
+	for _, want := range []string{`(default "[redacted]")`, "--token-file string", "(env $TEST_API_TOKEN)"} {
+		if !strings.Contains(have, want) {
+			t.Errorf("expected help to contain %q:\n%s", want, have)
+		}
+	}
+	if strings.Contains(have, "default-token") {
+		t.Errorf("expected default secret to be redacted:\n%s", have)
+	}
+	for _, line := range strings.Split(have, "\n") {
+		if strings.Contains(line, "--ttl ") && strings.Contains(line, "default") {
+			t.Errorf("expected zero default of secret to be omitted: %q", line)
+		}
+	}
+}
+
+func TestNamespacedSecrets(t *testing.T) {
+	t.Setenv("TEST_API_TOKEN", "from-env")
+	t.Setenv("SECRET_TEST_API_TOKEN", "from-namespaced-env")
+
+	var (
+		unit = secretConfig{}
+		g    = run.Group{Logger: telemetry.NoopLogger(), FlagNamespaces: true}
+	)
+	g.Register(&unit)
+	if err := g.RunConfig("--secret.pin", "1234"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want, have := "from-namespaced-env", unit.token; want != have {
+		t.Errorf("want token %q, have %q", want, have)
+	}
+
+	g = run.Group{Logger: telemetry.NoopLogger(), FlagNamespaces: true}
+	g.Register(&secretConfig{})
+	have := captureStdout(t, func() { _ = g.RunConfig("--help") })
+	for _, want := range []string{"read --secret.token from file", "(env $SECRET_TEST_API_TOKEN)"} {
+		if !strings.Contains(have, want) {
+			t.Errorf("expected help to contain %q:\n%s", want, have)
+		}
+	}
+}
+
+type secretConfig struct {
+	token string
+	pin   int
+	ttl   time.Duration
+}
+
+func (s secretConfig) Name() string { return "secret" }
+
+func (s *secretConfig) FlagSet() *run.FlagSet {
+	flags := run.NewFlagSet("secret config")
+	flags.StringVar(&s.token, "token", "default-token", "api token")
+	flags.IntVar(&s.pin, "pin", 0, "pin code")
+	_ = flags.SecretEnv("token", "TEST_API_TOKEN")
+	flags.DurationVar(&s.ttl, "ttl", 0, "token ttl")
+	_ = flags.MarkSecret("pin")
+	_ = flags.MarkSecret("ttl")
+	return flags
+}
+
+func (s secretConfig) Validate() error {
+	if s.token == "leaked-token" {
+		return fmt.Errorf("invalid token %q", s.token)
+	}
+	return nil
+}
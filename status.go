@@ -0,0 +1,164 @@
+// Copyright (c) Tetrate, Inc 2022.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"sync"
+	"time"
+)
+
+// UnitState holds the lifecycle state of a Service or ServiceContext Unit.
+type UnitState string
+
+// Lifecycle states of Service and ServiceContext Units.
+const (
+	// StateServing is the state of a Unit whose Serve or ServeContext method
+	// is running.
+	StateServing UnitState = "serving"
+	// StateStopping is the state of a Unit which was asked to stop, but whose
+	// Serve or ServeContext method has not returned yet.
+	StateStopping UnitState = "stopping"
+	// StateStopped is the state of a Unit whose Serve or ServeContext method
+	// has returned.
+	StateStopped UnitState = "stopped"
+)
+
+// UnitStatus holds the lifecycle state of a Service or ServiceContext Unit.
+type UnitStatus struct {
+	Name  string
+	State UnitState
+	// Since holds the moment the Unit entered its State.
+	Since time.Time
+}
+
+// StatusObserver is an extension interface that Units can implement to
+// observe the lifecycle state of the Service and ServiceContext Units of a
+// running Group, e.g. to report the Units still stopping when shutdown hangs.
+// ObserveStatus is called with a new Status for each Run, before the PreRunner
+// phase.
+type StatusObserver interface {
+	// Unit is embedded for Group registration and identification
+	Unit
+	ObserveStatus(s *Status)
+}
+
+// Drainer is an extension interface that Units can implement to be notified
+// when a Group is about to shut down, before its Units are asked to stop, e.g.
+// to fail readiness checks so load balancers stop routing traffic to the
+// process. Drain is called by the Unit initiating the drain, like a
+// signal.Handler with a drain delay, through Status.Drain.
+type Drainer interface {
+	// Unit is embedded for Group registration and identification
+	Unit
+	Drain()
+}
+
+// Status reports the lifecycle state of the Service and ServiceContext Units
+// of a running Group. It is safe for concurrent use.
+type Status struct {
+	mu       sync.Mutex
+	units    []UnitStatus
+	drainers []Drainer
+	draining bool
+	done     chan struct{}
+}
+
+func newStatus(drainers []Drainer) *Status {
+	return &Status{drainers: drainers, done: make(chan struct{})}
+}
+
+// Units returns the state of the Service Units followed by the ServiceContext
+// Units, each in order of registration. It returns an empty slice before the
+// Service phase starts.
+func (s *Status) Units() []UnitStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]UnitStatus(nil), s.units...)
+}
+
+// Stopping returns the names of the Units asked to stop which have not
+// returned yet.
+func (s *Status) Stopping() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var names []string
+	for _, u := range s.units {
+		if u.State == StateStopping {
+			names = append(names, u.Name)
+		}
+	}
+	return names
+}
+
+// Drain notifies the Drainer Units of the Group that shutdown is imminent.
+// Only the first call notifies the Drainers.
+func (s *Status) Drain() {
+	s.mu.Lock()
+	if s.draining {
+		s.mu.Unlock()
+		return
+	}
+	s.draining = true
+	s.mu.Unlock()
+	for _, d := range s.drainers {
+		d.Drain()
+	}
+}
+
+// Draining reports whether Drain was called.
+func (s *Status) Draining() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.draining
+}
+
+// Done returns a channel which is closed when Run returns.
+func (s *Status) Done() <-chan struct{} {
+	return s.done
+}
+
+// serve registers the Units entering the Service phase.
+func (s *Status) serve(names []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, name := range names {
+		s.units = append(s.units, UnitStatus{Name: name, State: StateServing, Since: now})
+	}
+}
+
+// stopping marks all Units still serving as stopping.
+func (s *Status) stopping() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for idx := range s.units {
+		if s.units[idx].State == StateServing {
+			s.units[idx].State, s.units[idx].Since = StateStopping, now
+		}
+	}
+}
+
+// stopped marks the Unit at idx as stopped.
+func (s *Status) stopped(idx int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.units[idx].State, s.units[idx].Since = StateStopped, time.Now()
+}
+
+// close marks the end of Run.
+func (s *Status) close() {
+	close(s.done)
+}